@@ -0,0 +1,133 @@
+package chidleystein
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BoolVocabulary is a pair of spellings of true and false, such as Y and
+// N, beyond those of strconv.ParseBool.
+type BoolVocabulary struct {
+	True, False string
+}
+
+// DefaultBoolVocabularies are the vocabularies the chidley command checks
+// unless told otherwise.
+var DefaultBoolVocabularies = []BoolVocabulary{
+	{True: "Y", False: "N"},
+	{True: "yes", False: "no"},
+	{True: "on", False: "off"},
+}
+
+func (b BoolVocabulary) String() string {
+	return b.True + "/" + b.False
+}
+
+// ParseBoolVocabulary returns the vocabulary spelled true/false, e.g. Y/N.
+func ParseBoolVocabulary(s string) (BoolVocabulary, error) {
+	i := strings.Index(s, "/")
+	if i <= 0 || i == len(s)-1 || strings.Count(s, "/") != 1 || strings.TrimSpace(s) != s {
+		return BoolVocabulary{}, fmt.Errorf("chidley: bad boolean vocabulary %q (want true/false, e.g. Y/N)", s)
+	}
+	b := BoolVocabulary{True: s[:i], False: s[i+1:]}
+	if b.True == b.False {
+		return BoolVocabulary{}, fmt.Errorf("chidley: bad boolean vocabulary %q (true and false are the same)", s)
+	}
+	return b, nil
+}
+
+// typeName is the name of the bool type generated for b, e.g. BoolYN or
+// BoolYesNo.
+func (b BoolVocabulary) typeName() string {
+	return "Bool" + capitalizeFirstLetter(identifier(b.True)) + capitalizeFirstLetter(identifier(b.False))
+}
+
+func boolVocabularyBlockKey(b BoolVocabulary) string {
+	return "bool " + b.String()
+}
+
+type boolVocabularyInfo struct {
+	vocabulary BoolVocabulary
+	always     bool
+}
+
+// addBoolVocabularies makes nti check the vocabularies too.
+func (nti *NodeTypeInfo) addBoolVocabularies(vocabularies []BoolVocabulary) {
+	for _, b := range vocabularies {
+		nti.boolVocabularies = append(nti.boolVocabularies, &boolVocabularyInfo{vocabulary: b, always: true})
+	}
+}
+
+// alwaysBoolVocabulary reports whether all the values seen are spelled
+// in b.
+func (nti *NodeTypeInfo) alwaysBoolVocabulary(b BoolVocabulary) bool {
+	for _, info := range nti.boolVocabularies {
+		if info.vocabulary == b {
+			return info.always
+		}
+	}
+	return false
+}
+
+// boolVocabulary returns the first vocabulary all the values seen by nti
+// are spelled in, or nil.
+func (nti *NodeTypeInfo) boolVocabulary() *BoolVocabulary {
+	for _, info := range nti.boolVocabularies {
+		if info.always {
+			return &info.vocabulary
+		}
+	}
+	return nil
+}
+
+// boolTypeNames returns the names of the types that may be generated for
+// vocabularies, so that no struct takes them.
+func boolTypeNames(vocabularies []BoolVocabulary) []string {
+	var names []string
+	for _, b := range vocabularies {
+		names = append(names, b.typeName(), "Null"+b.typeName())
+	}
+	return names
+}
+
+// printBoolTypes writes the types generated for vocabularies, by name.
+func printBoolTypes(lineChannel chan string, vocabularies map[string]BoolVocabulary) {
+	var names []string
+	for name := range vocabularies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b := vocabularies[name]
+		lineChannel <- strings.NewReplacer("NAME", name, "TRUE", strconv.Quote(b.True), "FALSE", strconv.Quote(b.False)).Replace(boolSource)
+	}
+}
+
+const boolSource = `// NAME is a bool read and written as TRUE or FALSE.
+type NAME bool
+
+func (b NAME) MarshalText() ([]byte, error) {
+	if b {
+		return []byte(TRUE), nil
+	}
+	return []byte(FALSE), nil
+}
+
+func (b *NAME) UnmarshalText(text []byte) error {
+	switch s := strings.TrimSpace(string(text)); s {
+	case TRUE:
+		*b = true
+	case FALSE:
+		*b = false
+	default:
+		return fmt.Errorf("invalid NAME %q", s)
+	}
+	return nil
+}
+
+func (b NAME) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bool(b))
+}
+`
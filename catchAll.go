@@ -0,0 +1,52 @@
+package chidleystein
+
+// anyElementType is the type of the element catch-all fields.
+const anyElementType = "AnyElement"
+
+// hasCatchAll reports whether the struct of n gets catch-all fields: on
+// every struct, or on those of the elements named in elements.
+func hasCatchAll(all bool, elements map[string]bool, n *Node) bool {
+	return all || elements[n.Name]
+}
+
+func (o Options) hasCatchAll(n *Node) bool {
+	return hasCatchAll(o.CatchAll, o.CatchAllElements, n)
+}
+
+// hasCatchAll reports whether some struct gets catch-all fields.
+func (s *Schema) hasCatchAll() bool {
+	for _, n := range s.ex.GlobalNodeMap {
+		if s.Options.hasCatchAll(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// printCatchAllFields writes the fields of the struct of n keeping the
+// child elements and attributes no other field takes. An element with
+// mixed content keeps its unknown children in its nodes, or in its
+// inner XML.
+func (v *PrintGoStructVisitor) printCatchAllFields(n *Node) {
+	if !n.mixed {
+		v.lineChannel <- "\tAny []" + anyElementType + " `xml:\",any\" json:\"any,omitempty\"`"
+		v.usesAnyElement = true
+	}
+	v.lineChannel <- "\tAnyAttrs []xml.Attr `xml:\",any,attr\" json:\"anyAttrs,omitempty\"`"
+}
+
+// printCatchAllTypes writes the type of the element catch-alls, if used.
+func printCatchAllTypes(lineChannel chan string, used bool) {
+	if used {
+		lineChannel <- anyElementSource
+	}
+}
+
+const anyElementSource = `// AnyElement is an element no struct field was generated for, kept as
+// is to be written back.
+type AnyElement struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr ` + "`xml:\",any,attr\" json:\"attrs,omitempty\"`" + `
+	InnerXML string     ` + "`xml:\",innerxml\" json:\"innerxml,omitempty\"`" + `
+}
+`
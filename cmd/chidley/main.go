@@ -1,15 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"go/token"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime"
-	"sort"
 	"strings"
-	"text/template"
 
 	"github.com/mattetti/chidley-stein"
 )
@@ -24,36 +25,64 @@ var (
 	codeGenConvert      bool
 	readFromStandardIn  bool
 	sortByXmlOrder      bool
-	codeGenDir          = "codegen"
-	codeGenFilename     = "CodeGenStructs.go"
 )
 
-// Java out
-const javaBasePackage = "ca.gnewton.chidley"
-const mavenJavaBase = "src/main/java"
-
 var (
-	javaBasePackagePath = strings.Replace(javaBasePackage, ".", "/", -1)
-	javaAppName         = "jaxb"
-	// writeJava           = false
+	writeJava           = false
 	baseJavaDir         = "java"
+	javaAppName         = "jaxb"
 	userJavaPackageName = ""
-	namePrefix          = "Chi"
-	nameSuffix          = ""
-	xmlName             = false
-	url                 = false
-	useType             = false
-	addDbMetadata       = false
 )
 
-type structSortFunc func(v *chidleystein.PrintGoStructVisitor)
+var (
+	namePrefix     = "Chi"
+	nameSuffix     = ""
+	xmlName        = false
+	url            = false
+	useType        = false
+	addDbMetadata  = false
+	workers        = 0
+	keying         = "name"
+	shareTypes     = false
+	useOccurs      = false
+	provenance     = false
+	samples        = "off"
+	mixedContent   = "nodes"
+	mixedElements  stringList
+	catchAll       stringList
+	typePolicy     = "signed"
+	fieldPolicies  stringList
+	timeLayouts    stringList
+	boolWords      stringList
+	tupleFields    stringList
+	strictness     = "lenient"
+	reportFile     = ""
+	enumLimit      = 0
+	sharedNaming   = "first"
+	writeModelFile = ""
+	readModelFiles stringList
+	// explainPath is the element path or path@attribute of chidley
+	// explain, and args the inputs.
+	explainPath string
+	args        []string
+)
 
-var structSort = printStructsAlphabetical
+// stringList is a flag.Value collecting every use of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
 
 var outputs = []*bool{
 	&codeGenConvert,
 	&structsToStdout,
-	// &writeJava,
+	&writeJava,
 }
 
 func init() {
@@ -69,27 +98,56 @@ func init() {
 	flag.BoolVar(&structsToStdout, "G", structsToStdout, "Only write generated Go structs to stdout")
 	// flag.BoolVar(&url, "u", url, "Filename interpreted as an URL")
 	flag.BoolVar(&useType, "t", useType, "Use type info obtained from XML (int, bool, etc); default is to assume everything is a string; better chance at working if XMl sample is not complete")
-	// flag.BoolVar(&writeJava, "J", writeJava, "Generated Java code for Java/JAXB")
+	flag.BoolVar(&writeJava, "J", writeJava, "Generated Java code for Java/JAXB; classes are named after their element, so only with -K name")
+	flag.StringVar(&baseJavaDir, "D", baseJavaDir, "Base directory for generated Java code (root of maven project)")
+	flag.StringVar(&javaAppName, "k", javaAppName, "App name for Java code (appended to ca.gnewton.chidley Java package name))")
+	flag.StringVar(&userJavaPackageName, "P", userJavaPackageName, "Java package name (rightmost in full package name")
 	flag.BoolVar(&xmlName, "x", xmlName, "Add XMLName (Space, Local) for each XML element, to JSON")
 	flag.StringVar(&attributePrefix, "a", attributePrefix, "Prefix to attribute names")
-	// flag.StringVar(&baseJavaDir, "D", baseJavaDir, "Base directory for generated Java code (root of maven project)")
-	// flag.StringVar(&javaAppName, "k", javaAppName, "App name for Java code (appended to ca.gnewton.chidley Java package name))")
 	flag.StringVar(&namePrefix, "e", namePrefix, "Prefix to struct (element) names; must start with a capital")
-	// flag.StringVar(&userJavaPackageName, "P", userJavaPackageName, "Java package name (rightmost in full package name")
+	flag.StringVar(&keying, "K", keying, "Tell same-named elements apart by: name (one type per name), parent (parent name) or path (full path); identical types are shared")
+	flag.BoolVar(&shareTypes, "S", shareTypes, "Share one struct between elements of different names with identical structure")
+	flag.StringVar(&sharedNaming, "N", sharedNaming, "Name of shared structs (-S): first (first element found), common (longest part the element names have in common) or numbered")
+	flag.BoolVar(&provenance, "i", provenance, "Comment each generated struct, field and Java class with the file, line, column and byte offset where it was first seen")
+	flag.StringVar(&samples, "v", samples, "Comment text and attribute fields with sample values: off, show (quoted, truncated) or redact (shape only, e.g. XX-99 for AB-12)")
+	flag.StringVar(&mixedContent, "C", mixedContent, "Field for the content of elements mixing text and child elements: nodes (slice of text runs and elements, in order) or innerxml (raw XML)")
+	flag.Var(&mixedElements, "Y", "Field for the mixed content of one element, as element=nodes or element=innerxml (repeatable)")
+	flag.Var(&catchAll, "A", "Give the struct of this element catch-all fields keeping unseen child elements and attributes, or * for every struct; the converter reports them with -u (repeatable)")
+	flag.BoolVar(&useOccurs, "O", useOccurs, "Shape fields by occurrences: a value for a child always present once, a slice if ever repeated, a pointer otherwise")
+	flag.StringVar(&typePolicy, "T", typePolicy, "Type policy with -t: signed (smallest signed type), smallest (smallest type, unsigned if never negative) or canonical (int64, uint64 and float64 only)")
+	flag.Var(&fieldPolicies, "F", "Type policy for one field, as element=policy for its text or element@attribute=policy (repeatable)")
+	flag.Var(&timeLayouts, "L", "Time layout, in Go reference time syntax (e.g. 02/01/2006), tried with -t before the XML Schema date and time forms (repeatable)")
+	flag.Var(&boolWords, "b", "Spellings of true and false, as true/false, tried with -t after the Go ones; replaces the default Y/N, yes/no and on/off (repeatable; none for no vocabulary)")
+	flag.Var(&tupleFields, "l", "Names of the fields of the tuples of a list of comma-separated parts with -t, as element=Name,Name for its text or element@attribute=Name,Name, e.g. coordinates=Lon,Lat,Alt (repeatable)")
+	flag.StringVar(&strictness, "s", strictness, "Which spellings count as typed values with -t: lenient (anything Go parses), xsd (XML Schema lexical forms) or strict (xsd without leading zeros, \"+\", NaN, INF, 1/0 booleans or floats written back otherwise)")
+	flag.StringVar(&reportFile, "R", reportFile, "Write the type inferred for each text and attribute, with the values that ruled out other types, to this file (- for stderr)")
+	flag.IntVar(&enumLimit, "E", enumLimit, "Make fields with at most this many distinct values (one seen twice) a string type with a constant per value; with -s strict, unknown values are refused (0: off)")
+	flag.IntVar(&workers, "w", workers, "Number of input files extracted in parallel (default: number of CPUs)")
+	flag.StringVar(&writeModelFile, "M", writeModelFile, "Write the inferred model as JSON to this file")
+	flag.Var(&readModelFiles, "m", "Read and merge a JSON model written by -M (repeatable); the XML input becomes optional")
 }
 
 func handleParameters() error {
+	// chidley explain [flags] path input...
+	if len(os.Args) > 1 && os.Args[1] == "explain" {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+		flag.Parse()
+		if flag.NArg() == 0 {
+			return errors.New("explain needs an element path or path@attribute")
+		}
+		explainPath = flag.Arg(0)
+		args = flag.Args()[1:]
+		return nil
+	}
 	flag.Parse()
+	args = flag.Args()
 
 	numBoolsSet := countNumberOfBoolsSet(outputs)
 	if numBoolsSet > 1 {
 		log.Print("  ERROR: Only one of -W -J -X -V -c can be set")
-	} else if numBoolsSet == 0 {
+	} else if numBoolsSet == 0 && writeModelFile == "" && reportFile == "" {
 		log.Print("  ERROR: At least one of -W -J -X -V -c must be set")
 	}
-	if sortByXmlOrder {
-		structSort = printStructsByXml
-	}
 	return nil
 }
 
@@ -101,230 +159,312 @@ func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
 	if err != nil {
+		log.Print("  ERROR: " + err.Error())
 		flag.Usage()
 		return
 	}
 
-	if len(flag.Args()) != 1 && !readFromStandardIn {
-		fmt.Println("chidley <flags> xmlFileName|url")
+	hasXML := len(args) > 0 || readFromStandardIn
+	if (url && len(args) != 1) || (!hasXML && len(readModelFiles) == 0) {
+		fmt.Println("chidley <flags> xmlFileName|directory|glob ...|url")
+		fmt.Println("chidley explain <flags> path|path@attribute xmlFileName|directory|glob ...|url")
 		fmt.Println("xmlFileName can be .gz or .bz2: uncompressed transparently")
 		flag.Usage()
 		return
 	}
 
-	var sourceName string
-
-	if !readFromStandardIn {
-		sourceName = flag.Args()[0]
+	opts := chidleystein.Options{
+		NamePrefix:          namePrefix,
+		NameSuffix:          nameSuffix,
+		AttributePrefix:     attributePrefix,
+		UseType:             useType,
+		NameSpaceInJsonName: nameSpaceInJsonName,
+		AddDbMetadata:       addDbMetadata,
+		SortByXmlOrder:      sortByXmlOrder,
+		Progress:            progress,
+		Debug:               DEBUG,
+		Workers:             workers,
+		ShareTypes:          shareTypes,
+		UseOccurs:           useOccurs,
+		Provenance:          provenance,
+		TimeLayouts:         timeLayouts,
+		EnumLimit:           enumLimit,
 	}
-	if !url && !readFromStandardIn {
-		sourceName, err = filepath.Abs(sourceName)
-		if err != nil {
-			log.Fatal("FATAL ERROR: " + err.Error())
-		}
+	opts.SharedTypeNaming, err = chidleystein.ParseSharedTypeNaming(sharedNaming)
+	if err != nil {
+		log.Fatal("FATAL ERROR: " + err.Error())
 	}
-
-	source, err := makeSourceReader(sourceName, url, readFromStandardIn)
+	opts.Keying, err = chidleystein.ParseNodeKeying(keying)
 	if err != nil {
 		log.Fatal("FATAL ERROR: " + err.Error())
 	}
-
-	ex := chidleystein.Extractor{
-		NamePrefix: namePrefix,
-		// NameSuffix: nameSuffix,
-		Reader: source.GetReader(),
-		// useType:    useType,
-		// progress:   progress,
+	opts.TypePolicy, err = chidleystein.ParseTypePolicy(typePolicy)
+	if err != nil {
+		log.Fatal("FATAL ERROR: " + err.Error())
 	}
-
-	// if DEBUG {
-	log.Print("extracting")
-	// }
-	err = ex.Extract()
+	opts.FieldTypePolicies, err = parseFieldPolicies(fieldPolicies)
+	if err != nil {
+		log.Fatal("FATAL ERROR: " + err.Error())
+	}
+	opts.Strictness, err = chidleystein.ParseStrictness(strictness)
+	if err != nil {
+		log.Fatal("FATAL ERROR: " + err.Error())
+	}
+	opts.BoolVocabularies, err = parseBoolVocabularies(boolWords)
+	if err != nil {
+		log.Fatal("FATAL ERROR: " + err.Error())
+	}
+	opts.TupleFields, err = parseTupleFields(tupleFields)
 	if err != nil {
 		log.Fatal("FATAL ERROR: " + err.Error())
 	}
+	opts.SampleComments, err = chidleystein.ParseSampleComments(samples)
+	if err != nil {
+		log.Fatal("FATAL ERROR: " + err.Error())
+	}
+	opts.MixedContent, err = chidleystein.ParseMixedContent(mixedContent)
+	if err != nil {
+		log.Fatal("FATAL ERROR: " + err.Error())
+	}
+	opts.MixedElements, err = parseMixedElements(mixedElements)
+	if err != nil {
+		log.Fatal("FATAL ERROR: " + err.Error())
+	}
+	opts.CatchAll, opts.CatchAllElements = parseCatchAll(catchAll)
 
-	var writer chidleystein.Writer
-	lineChannel := make(chan string, 100)
-	switch {
-	case codeGenConvert:
-		sWriter := new(chidleystein.StringWriter)
-		writer = sWriter
-		writer.Open("", lineChannel)
-
-		printGoStructVisitor := new(chidleystein.PrintGoStructVisitor)
-		printGoStructVisitor.Init(lineChannel, 9999,
-			ex.GlobalTagAttributes,
-			ex.NameSpaceTagMap,
-			useType,
-			nameSpaceInJsonName)
-		printGoStructVisitor.NamePrefix = namePrefix
-		printGoStructVisitor.NameSuffix = nameSuffix
-		printGoStructVisitor.AttributePrefix = attributePrefix
-
-		printGoStructVisitor.Visit(ex.Root)
-
-		structSort(printGoStructVisitor)
-
-		close(lineChannel)
-		sWriter.Close()
-
-		xt := chidleystein.XMLType{NameType: ex.FirstNode.MakeType(namePrefix, nameSuffix),
-			XMLName:      ex.FirstNode.Name,
-			XMLNameUpper: chidleystein.CapitalizeFirstLetter(ex.FirstNode.Name),
-			XMLSpace:     ex.FirstNode.Space,
+	var schema *chidleystein.Schema
+	for _, modelFile := range readModelFiles {
+		s, err := readModel(modelFile, opts)
+		if err != nil {
+			log.Fatal("FATAL ERROR: " + err.Error())
 		}
+		if schema == nil {
+			schema = s
+		} else {
+			if err := schema.Merge(s); err != nil {
+				log.Fatal("FATAL ERROR: " + err.Error())
+			}
+		}
+	}
 
-		x := chidleystein.XmlInfo{
-			BaseXML:         &xt,
-			OneLevelDownXML: makeOneLevelDown(ex.Root),
-			Filename:        chidleystein.GetFullPath(sourceName),
-			Structs:         sWriter.S,
+	var sourceName string
+	var xmlSchema *chidleystein.Schema
+	switch {
+	case !hasXML:
+	case url || readFromStandardIn:
+		if !readFromStandardIn {
+			sourceName = args[0]
+		}
+		source, err := chidleystein.NewSource(sourceName, url, readFromStandardIn)
+		if err != nil {
+			log.Fatal("FATAL ERROR: " + err.Error())
 		}
-		t := template.Must(template.New("chidleyGen").Parse(chidleystein.CodeTemplate))
+		defer source.Close()
 
-		err := t.Execute(os.Stdout, x)
+		if DEBUG {
+			log.Print("extracting")
+		}
+		xmlSchema, err = chidleystein.Infer(context.Background(), source.GetReader(), opts)
 		if err != nil {
-			log.Println("executing template:", err)
+			log.Fatal("FATAL ERROR: " + err.Error())
 		}
+	default:
+		filenames, err := chidleystein.ExpandPaths(args)
+		if err != nil {
+			log.Fatal("FATAL ERROR: " + err.Error())
+		}
+		for i := range filenames {
+			filenames[i], err = filepath.Abs(filenames[i])
+			if err != nil {
+				log.Fatal("FATAL ERROR: " + err.Error())
+			}
+		}
+		if len(filenames) == 0 {
+			log.Fatal("FATAL ERROR: no XML files found in ", args)
+		}
+		sourceName = filenames[0]
 
-	case structsToStdout:
-		writer = new(chidleystein.StdoutWriter)
-		writer.Open("", lineChannel)
-		printGoStructVisitor := new(chidleystein.PrintGoStructVisitor)
-		printGoStructVisitor.Init(lineChannel, 999, ex.GlobalTagAttributes, ex.NameSpaceTagMap, useType, nameSpaceInJsonName)
-		printGoStructVisitor.Visit(ex.Root)
-		structSort(printGoStructVisitor)
-		close(lineChannel)
-		writer.Close()
+		if DEBUG {
+			log.Printf("extracting %d files", len(filenames))
+		}
+		xmlSchema, err = chidleystein.InferFiles(context.Background(), filenames, opts)
+		if err != nil {
+			log.Fatal("FATAL ERROR: " + err.Error())
+		}
 	}
-
-}
-
-const XMLNS = "xmlns"
-
-func findNameSpaces(attributes []*chidleystein.FQN) []*chidleystein.FQN {
-	if attributes == nil || len(attributes) == 0 {
-		return nil
+	if xmlSchema != nil {
+		if schema == nil {
+			schema = xmlSchema
+		} else {
+			if err := schema.Merge(xmlSchema); err != nil {
+				log.Fatal("FATAL ERROR: " + err.Error())
+			}
+		}
 	}
-	xmlns := make([]*chidleystein.FQN, 0)
-	return xmlns
-}
 
-func makeSourceReader(sourceName string, url bool, standardIn bool) (chidleystein.Source, error) {
-	var err error
+	if writeModelFile != "" {
+		if err := writeModel(writeModelFile, schema); err != nil {
+			log.Fatal("FATAL ERROR: " + err.Error())
+		}
+	}
+	if reportFile != "" {
+		if err := writeTypeReport(reportFile, schema); err != nil {
+			log.Fatal("FATAL ERROR: " + err.Error())
+		}
+	}
+	if explainPath != "" {
+		if err := schema.Explain(os.Stdout, explainPath); err != nil {
+			log.Fatal("FATAL ERROR: " + err.Error())
+		}
+		return
+	}
 
-	var source chidleystein.Source
-	if url {
-		source = new(chidleystein.UrlSource)
-		if DEBUG {
-			log.Print("Making UrlSource")
+	switch {
+	case codeGenConvert:
+		err = schema.WriteGoConverter(os.Stdout, sourceName)
+	case structsToStdout:
+		err = schema.WriteGoStructs(os.Stdout)
+	case writeJava:
+		if userJavaPackageName != "" {
+			javaAppName = userJavaPackageName
 		}
-	} else {
-		if standardIn {
-			source = new(chidleystein.StdinSource)
-			if DEBUG {
-				log.Print("Making StdinSource")
-			}
-		} else {
-			source = new(chidleystein.FileSource)
-			if DEBUG {
-				log.Print("Making FileSource")
-			}
+		if err := schema.WriteJava(baseJavaDir, javaAppName, sourceName); err != nil {
+			log.Fatal("FATAL ERROR: " + err.Error())
 		}
 	}
-	if DEBUG {
-		log.Print("Making Source:[" + sourceName + "]")
+	if err != nil {
+		log.Println("executing template:", err)
 	}
-	err = source.NewSource(sourceName)
-	return source, err
 }
 
-func attributes(atts map[string]bool) string {
-	ret := ": "
-	for k, _ := range atts {
-		ret = ret + k + ", "
+// parseFieldPolicies parses the field=policy values of -F.
+func parseFieldPolicies(values []string) (map[string]chidleystein.TypePolicy, error) {
+	policies := make(map[string]chidleystein.TypePolicy)
+	for _, value := range values {
+		i := strings.LastIndex(value, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("bad -F %q: want field=policy", value)
+		}
+		policy, err := chidleystein.ParseTypePolicy(value[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		policies[value[:i]] = policy
 	}
-	return ret
+	return policies, nil
 }
 
-func indent(d int) string {
-	indent := ""
-	for i := 0; i < d; i++ {
-		indent = indent + "\t"
+func parseMixedElements(values []string) (map[string]chidleystein.MixedContent, error) {
+	elements := make(map[string]chidleystein.MixedContent)
+	for _, value := range values {
+		i := strings.LastIndex(value, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("bad -Y %q: want element=nodes or element=innerxml", value)
+		}
+		m, err := chidleystein.ParseMixedContent(value[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		elements[value[:i]] = m
 	}
-	return indent
+	return elements, nil
 }
 
-func lowerFirstLetter(s string) string {
-	return strings.ToLower(s[0:1]) + s[1:]
+// parseCatchAll parses the elements of -A, where * stands for all.
+func parseCatchAll(values []string) (bool, map[string]bool) {
+	all := false
+	elements := make(map[string]bool)
+	for _, value := range values {
+		if value == "*" {
+			all = true
+		} else {
+			elements[value] = true
+		}
+	}
+	return all, elements
 }
 
-func countNumberOfBoolsSet(a []*bool) int {
-	counter := 0
-	for i := 0; i < len(a); i++ {
-		if *a[i] {
-			counter += 1
+// parseBoolVocabularies parses the true/false values of -b, defaulting
+// to chidleystein.DefaultBoolVocabularies.
+func parseBoolVocabularies(values []string) ([]chidleystein.BoolVocabulary, error) {
+	if len(values) == 0 {
+		return chidleystein.DefaultBoolVocabularies, nil
+	}
+	var vocabularies []chidleystein.BoolVocabulary
+	for _, value := range values {
+		if value == "none" {
+			continue
+		}
+		b, err := chidleystein.ParseBoolVocabulary(value)
+		if err != nil {
+			return nil, err
 		}
+		vocabularies = append(vocabularies, b)
 	}
-	return counter
+	return vocabularies, nil
 }
 
-func makeOneLevelDown(node *chidleystein.Node) []*chidleystein.XMLType {
-	var children []*chidleystein.XMLType
-
-	for _, np := range node.Children {
-		if np == nil {
-			continue
+// parseTupleFields parses the field=Name,Name values of -l.
+func parseTupleFields(values []string) (map[string][]string, error) {
+	fields := make(map[string][]string)
+	for _, value := range values {
+		i := strings.LastIndex(value, "=")
+		if i <= 0 || i == len(value)-1 {
+			return nil, fmt.Errorf("bad -l %q: want field=Name,Name", value)
 		}
-		for _, n := range np.Children {
-			if n == nil {
-				continue
+		names := strings.Split(value[i+1:], ",")
+		for _, name := range names {
+			if !token.IsIdentifier(name) || !token.IsExported(name) {
+				return nil, fmt.Errorf("bad -l %q: %q is not an exported Go name", value, name)
 			}
-			x := chidleystein.XMLType{NameType: n.MakeType(namePrefix, nameSuffix),
-				XMLName:      n.Name,
-				XMLNameUpper: chidleystein.CapitalizeFirstLetter(n.Name),
-				XMLSpace:     n.Space}
-			children = append(children, &x)
 		}
+		fields[value[:i]] = names
 	}
-	return children
+	return fields, nil
 }
-func printChildrenChildren(node *chidleystein.Node) {
-	for k, v := range node.Children {
-		log.Print(k)
-		log.Printf("children: %+v\n", v.Children)
+
+func readModel(filename string, opts chidleystein.Options) (*chidleystein.Schema, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
+	return chidleystein.ReadModel(f, opts)
 }
 
-// Order Xml is encountered
-func printStructsByXml(v *chidleystein.PrintGoStructVisitor) {
-	orderNodes := make(map[int]*chidleystein.Node)
-	var order []int
-
-	for k := range v.AlreadyVisitedNodes {
-		nodeOrder := v.AlreadyVisitedNodes[k].DiscoveredOrder
-		orderNodes[nodeOrder] = v.AlreadyVisitedNodes[k]
-		order = append(order, nodeOrder)
+func writeModel(filename string, schema *chidleystein.Schema) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
 	}
-	sort.Ints(order)
-
-	for o := range order {
-		v.Print(orderNodes[o])
+	if err := schema.WriteModel(f); err != nil {
+		f.Close()
+		return err
 	}
+	return f.Close()
 }
 
-// Alphabetical order
-func printStructsAlphabetical(v *chidleystein.PrintGoStructVisitor) {
-	var keys []string
-	for k := range v.AlreadyVisitedNodes {
-		keys = append(keys, k)
+func writeTypeReport(filename string, schema *chidleystein.Schema) error {
+	if filename == "-" {
+		return schema.WriteTypeReport(os.Stderr)
 	}
-	sort.Strings(keys)
-
-	for _, k := range keys {
-		v.Print(v.AlreadyVisitedNodes[k])
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
 	}
+	if err := schema.WriteTypeReport(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
 
+func countNumberOfBoolsSet(a []*bool) int {
+	counter := 0
+	for i := 0; i < len(a); i++ {
+		if *a[i] {
+			counter += 1
+		}
+	}
+	return counter
 }
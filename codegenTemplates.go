@@ -4,12 +4,36 @@ type XmlInfo struct {
 	BaseXML           *XMLType
 	OneLevelDownXML   []*XMLType
 	Structs, Filename string
+	// Imports are the packages the structs need besides those of
+	// CodeTemplate.
+	Imports []string
+	// Mixed is set if some element has mixed content, whose text the
+	// indentation of the XML written would change.
+	Mixed bool
+	// CatchAll is set if some struct has catch-all fields, which the
+	// converter can report on.
+	CatchAll bool
+	// NestedTypes are the structs leading back to themselves, which the
+	// converter reads and writes with a stack of its own.
+	NestedTypes []string
+	// ContentModels are those of every element, which the converter
+	// validates the input against, and Keying tells same-named elements
+	// apart as in the model.
+	ContentModels []*ContentModelInfo
+	Keying        string
 }
 
 type XMLType struct {
 	NameType, XMLName, XMLNameUpper, XMLSpace string
 }
 
+// ContentModelInfo is the content model of the elements of a node key,
+// written as in a DTD and as a regular expression over the keys of their
+// children.
+type ContentModelInfo struct {
+	Key, Model, Pattern string
+}
+
 const CodeTemplate = `package main
 
 /////////////////////////////////////////////////////////////////
@@ -26,9 +50,12 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"os"
-	"runtime"
-	"strings"
+	"os"{{if or .CatchAll .NestedTypes}}
+	"reflect"{{end}}
+	"runtime"{{if .CatchAll}}
+	"sort"{{end}}
+	"strings"{{range .Imports}}
+	"{{.}}"{{end}}
 
 	"github.com/mattetti/go-spew/spew"
 )
@@ -44,13 +71,17 @@ var toJson bool
 var toXml bool
 var oneLevelDown bool
 var countAll bool
-var musage bool
+var validate bool
+var musage bool{{if .CatchAll}}
+var reportUnknown bool{{end}}
 
 var uniqueFlags = []*bool{
 	&toJson,
 	&toXml,
 	&toGo,
-	&countAll}
+	&countAll,
+	&validate{{if .CatchAll}},
+	&reportUnknown{{end}}}
 
 var filename = "{{.Filename}}"
 
@@ -65,8 +96,10 @@ func init() {
 	flag.BoolVar(&toXml, "x", toXml, "Convert to XML")
 	flag.BoolVar(&countAll, "c", countAll, "Count each instance of XML tags")
 	flag.BoolVar(&toGo, "g", toGo, "Convert to Go")
+	flag.BoolVar(&validate, "V", validate, "Check the order and number of the child elements of each element against the content model inferred by chidley")
 	flag.BoolVar(&oneLevelDown, "s", oneLevelDown, "Stream XML by using XML elements one down from the root tag. Good for huge XML files (see http://blog.davidsingleton.org/parsing-huge-xml-files-with-go/")
-	flag.BoolVar(&musage, "h", musage, "Usage")
+	flag.BoolVar(&musage, "h", musage, "Usage"){{if .CatchAll}}
+	flag.BoolVar(&reportUnknown, "u", reportUnknown, "Count each element and attribute kept in a catch-all field, by path"){{end}}
 	flag.StringVar(&filename, "f", filename, "XML file or URL to read in")
 }
 
@@ -101,15 +134,26 @@ func main() {
 	}
 
 	decoder := xml.NewDecoder(reader)
+	if validate {
+		if invalid := validateContent(decoder); invalid > 0 {
+			log.Fatal(invalid, " elements do not match their content model")
+		}
+		return
+	}
 	counters = make(map[string]*int)
 	for {
-		token, _ := decoder.Token()
-		if token == nil {
+		token, err := decoder.Token()
+		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			log.Fatal(err)
+		}
 		switch se := token.(type) {
 		case xml.StartElement:
-			handleFeed(se, decoder, outFlag)
+			if err := handleFeed(se, decoder, outFlag); err != nil {
+				log.Fatal(err)
+			}
 		}
 	}
         if xmlFile != nil{
@@ -119,43 +163,62 @@ func main() {
 		for k, v := range counters {
 			fmt.Println(*v, k)
 		}
-	}
+	}{{if .CatchAll}}
+	if reportUnknown {
+		paths := make([]string, 0, len(unknownCounts))
+		for path := range unknownCounts {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			fmt.Println(unknownCounts[path], path)
+		}
+	}{{end}}
 }
 
-func handleFeed(se xml.StartElement, decoder *xml.Decoder, outFlag *bool) {
+func handleFeed(se xml.StartElement, decoder *xml.Decoder, outFlag *bool) error {
 	if outFlag == &countAll {
 		incrementCounter(se.Name.Space, se.Name.Local)
 	} else {
                 if !oneLevelDown{
         		if se.Name.Local == "{{.BaseXML.XMLName}}" && se.Name.Space == "{{.BaseXML.XMLSpace}}" {
 	        	      var item {{.BaseXML.NameType}}
-			      decoder.DecodeElement(&item, &se)
+			      if err := decoder.DecodeElement(&item, &se); err != nil {
+				      return err
+			      }
 			      switch outFlag {
 			      case &toJson:
 				      writeJson(item)
 			      case &toXml:
-					  writeXml(item)
+					  writeXml(item, se.Name)
 				  case &toGo:
-					  writeGo(item)
+					  writeGo(item){{if $.CatchAll}}
+				  case &reportUnknown:
+					  findUnknown(se.Name.Local, reflect.ValueOf(item)){{end}}
 			      }
 		      }
                 }else{
                    {{ range .OneLevelDownXML }}
         		if se.Name.Local == "{{.XMLName}}" && se.Name.Space == "{{.XMLSpace}}" {
 	        	      var item {{.NameType}}
-			      decoder.DecodeElement(&item, &se)
+			      if err := decoder.DecodeElement(&item, &se); err != nil {
+				      return err
+			      }
 			      switch outFlag {
 			      case &toJson:
 				      writeJson(item)
 			      case &toXml:
-					  writeXml(item)
+					  writeXml(item, se.Name)
 				  case &toGo:
-					  writeGo(item)
+					  writeGo(item){{if $.CatchAll}}
+				  case &reportUnknown:
+					  findUnknown(se.Name.Local, reflect.ValueOf(item)){{end}}
 			      }
 		      }
                    {{ end }}
                }
 	}
+	return nil
 }
 
 func makeKey(space string, local string) string {
@@ -183,19 +246,727 @@ func writeGo(item interface{}) {
 }
 
 func writeJson(item interface{}) {
-	b, err := json.MarshalIndent(item, "", " ")
+{{if .NestedTypes}}	w := bufio.NewWriter(os.Stdout)
+	if err := writeNestedJson(w, item); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintln(w)
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+{{else}}	b, err := json.MarshalIndent(item, "", " ")
 	if err != nil {
 		log.Fatal(err)
 	}
 	fmt.Println(string(b))
+{{end}}}
+
+// writeXml writes item as the element name it was read from, not as
+// its type.
+func writeXml(item interface{}, name xml.Name) {
+	encoder := xml.NewEncoder(os.Stdout)
+{{if not .Mixed}}	encoder.Indent("  ", "    ")
+{{end}}	if err := encoder.EncodeElement(item, xml.StartElement{Name: name}); err != nil {
+		fmt.Printf("error: %v\n", err)
+	}
 }
 
-func writeXml(item interface{}) {
-	output, err := xml.MarshalIndent(item, "  ", "    ")
-	if err != nil {
-		fmt.Printf("error: %v\n", err)
+{{if .CatchAll}}// unknownCounts counts the elements and attributes in catch-all fields,
+// by path.
+var unknownCounts = make(map[string]int)
+
+var anyElementType = reflect.TypeOf(AnyElement{})
+
+// findUnknown counts the contents of the catch-all fields in v, found at
+// path, and below it. It keeps a list of the values left to look at
+// rather than recursing, as elements may nest deeply.
+func findUnknown(path string, v reflect.Value) {
+	type value struct {
+		path string
+		v    reflect.Value
+	}
+	values := []value{value{path, v}}
+	for len(values) > 0 {
+		path, v := values[len(values)-1].path, values[len(values)-1].v
+		values = values[:len(values)-1]
+		switch v.Kind() {
+		case reflect.Ptr:
+			if !v.IsNil() {
+				values = append(values, value{path, v.Elem()})
+			}
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				values = append(values, value{path, v.Index(i)})
+			}
+		case reflect.Struct:
+			if v.Type() == anyElementType {
+				unknownCounts[path+"/"+v.Interface().(AnyElement).XMLName.Local] += 1
+				continue
+			}
+			for i := 0; i < v.NumField(); i++ {
+				f := v.Type().Field(i)
+				tag := f.Tag.Get("xml")
+				switch {
+				case tag == ",any,attr":
+					for _, attr := range v.Field(i).Interface().([]xml.Attr) {
+						unknownCounts[path+"@"+attr.Name.Local] += 1
+					}
+				case tag == ",any" || tag == "-" && f.Name == "Any":
+					values = append(values, value{path, v.Field(i)})
+				case tag == "-":
+					// A node of mixed content.
+					values = append(values, value{path + "/" + strings.Split(f.Tag.Get("json"), ",")[0], v.Field(i)})
+				case f.Type.Kind() == reflect.Ptr || f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.Ptr:
+					name := strings.Split(tag, ",")[0]
+					values = append(values, value{path + "/" + name[strings.LastIndex(name, " ")+1:], v.Field(i)})
+				}
+			}
+		}
+	}
+}
+
+{{end}}{{if .NestedTypes}}{{range .NestedTypes}}// UnmarshalXML and MarshalXML handle {{.}}, which leads back to itself,
+// as a nestedElement.
+func (x *{{.}}) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return decodeNested(d, start, x)
+}
+
+func (x {{.}}) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return encodeNested(e, start, &x)
+}
+
+func (x *{{.}}) plain() interface{} {
+	type plain {{.}}
+	return (*plain)(x)
+}
+
+{{end}}// nestedElement is a struct leading back to itself through its children.
+// Its elements are read and written with a stack of their own rather than
+// by recursion, as they may nest deeper than encoding/xml reads (10000
+// levels) or the Go stack holds.
+type nestedElement interface {
+	// plain returns the struct as a type without the methods reading and
+	// writing it, to read its attributes and text with encoding/xml.
+	plain() interface{}
+}
+
+var nestedElementType = reflect.TypeOf((*nestedElement)(nil)).Elem()
+
+// mixedElement is a nestedElement mixing text and child elements, which
+// it holds in order.
+type mixedElement interface {
+	addText(text string, more bool)
+	addChild(t xml.StartElement) interface{}
+}
+
+// mixedNode is a run of text or a child element of a mixedElement.
+type mixedNode interface {
+	element() (interface{}, xml.Name)
+}
+
+var mixedNodeType = reflect.TypeOf((*mixedNode)(nil)).Elem()
+
+// isNested reports whether a field of type t holds nested elements.
+func isNested(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Ptr && t.Implements(nestedElementType)
+}
+
+// xmlTag returns the element or attribute name in the xml tag of f, and
+// the options after it, such as ",attr,omitempty".
+func xmlTag(f reflect.StructField) (xml.Name, string) {
+	tag := f.Tag.Get("xml")
+	options := ""
+	if i := strings.Index(tag, ","); i >= 0 {
+		tag, options = tag[:i], tag[i:]
+	}
+	parts := strings.Fields(tag)
+	switch len(parts) {
+	case 0:
+		return xml.Name{}, options
+	case 1:
+		return xml.Name{Local: parts[0]}, options
+	}
+	return xml.Name{Space: parts[0], Local: parts[1]}, options
+}
+
+func hasOption(options string, option string) bool {
+	return strings.Contains(options+",", ","+option+",")
+}
+
+// elementField returns the field of v holding the child element name,
+// or its catch-all field.
+func elementField(v reflect.Value, name xml.Name) (reflect.Value, bool) {
+	var any reflect.Value
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		tagName, options := xmlTag(f)
+		switch {
+		case f.Name == "XMLName" || f.Tag.Get("xml") == "-":
+		case hasOption(options, "attr") || hasOption(options, "chardata") || hasOption(options, "innerxml"):
+		case hasOption(options, "any"):
+			any = v.Field(i)
+		case tagName.Local == name.Local && (tagName.Space == "" || tagName.Space == name.Space):
+			return v.Field(i), true
+		}
+	}
+	return any, any.IsValid()
+}
+
+// nestedTokens replays the start, text and end of an element.
+type nestedTokens []xml.Token
+
+func (t *nestedTokens) Token() (xml.Token, error) {
+	if len(*t) == 0 {
+		return nil, io.EOF
+	}
+	token := (*t)[0]
+	*t = (*t)[1:]
+	return token, nil
+}
+
+// nestedDepth counts the levels of nested elements read by decodeNested
+// above the element it reads.
+var nestedDepth int
+
+// decodeChild reads the element start from d into v, depth levels of
+// nested elements below nestedDepth. encoding/xml reads into nothing
+// below 10000 levels of elements, so deeper down the element is read
+// apart from d.
+func decodeChild(d *xml.Decoder, start xml.StartElement, v interface{}, depth int) error {
+	nestedDepth += depth
+	defer func() {
+		nestedDepth -= depth
+	}()
+	if nestedDepth < 9000 {
+		return d.DecodeElement(v, &start)
+	}
+	return decodeApart(d, start, v)
+}
+
+// decodeApart reads the element start from d into v by writing it out
+// again and reading that with a decoder of its own.
+func decodeApart(d *xml.Decoder, start xml.StartElement, v interface{}) error {
+	var b bytes.Buffer
+	e := xml.NewEncoder(&b)
+	token := xml.Token(start)
+	for depth := 0; ; {
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			// The encoder declares the namespaces it needs itself.
+			attrs := t.Attr[:0:0]
+			for _, attr := range t.Attr {
+				if attr.Name.Space != "xmlns" && !(attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+					attrs = append(attrs, attr)
+				}
+			}
+			t.Attr = attrs
+			token = t
+		case xml.EndElement:
+			depth--
+		}
+		if err := e.EncodeToken(token); err != nil {
+			return err
+		}
+		if depth == 0 {
+			break
+		}
+		var err error
+		if token, err = d.Token(); err != nil {
+			return err
+		}
+	}
+	if err := e.Flush(); err != nil {
+		return err
+	}
+	return xml.NewDecoder(&b).Decode(v)
+}
+
+// decodeNested reads the element start into x. The children leading back
+// to x go on a stack; the others, and the attributes and text, are read
+// by encoding/xml.
+func decodeNested(d *xml.Decoder, start xml.StartElement, x nestedElement) error {
+	type element struct {
+		x     nestedElement
+		start xml.StartElement
+		text  []byte
+		// more is set after text in mixed content.
+		more bool
+	}
+	open := []*element{&element{x: x, start: start.Copy()}}
+	for len(open) > 0 {
+		top := open[len(open)-1]
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		mixed, isMixed := top.x.(mixedElement)
+		switch t := token.(type) {
+		case xml.StartElement:
+			if isMixed {
+				top.more = false
+				switch child := mixed.addChild(t).(type) {
+				case nil:
+					err = d.Skip()
+				case nestedElement:
+					open = append(open, &element{x: child, start: t.Copy()})
+				default:
+					err = decodeChild(d, t, child, len(open))
+				}
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			field, ok := elementField(reflect.ValueOf(top.x).Elem(), t.Name)
+			switch {
+			case !ok:
+				err = d.Skip()
+			case isNested(field.Type()):
+				var child reflect.Value
+				if field.Kind() == reflect.Slice {
+					child = reflect.New(field.Type().Elem().Elem())
+					field.Set(reflect.Append(field, child))
+				} else {
+					child = reflect.New(field.Type().Elem())
+					field.Set(child)
+				}
+				open = append(open, &element{x: child.Interface().(nestedElement), start: t.Copy()})
+			case field.Kind() == reflect.Slice:
+				item := reflect.New(field.Type().Elem())
+				err = decodeChild(d, t, item.Interface(), len(open))
+				field.Set(reflect.Append(field, item.Elem()))
+			default:
+				err = decodeChild(d, t, field.Addr().Interface(), len(open))
+			}
+			if err != nil {
+				return err
+			}
+		case xml.CharData:
+			if isMixed {
+				mixed.addText(string(t), top.more)
+				top.more = true
+			} else {
+				top.text = append(top.text, t...)
+			}
+		case xml.EndElement:
+			tokens := nestedTokens{top.start, xml.CharData(top.text), top.start.End()}
+			if err := xml.NewTokenDecoder(&tokens).Decode(top.x.plain()); err != nil {
+				return err
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	return nil
+}
+
+// isEmptyValue reports whether v is empty, as omitempty means it.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Struct:
+		return false
+	}
+	return v.IsZero()
+}
+
+// textOf returns v as text, as encoding/xml writes an attribute or text;
+// ok is false for a nil pointer.
+func textOf(v reflect.Value) (text string, ok bool, err error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false, nil
+		}
+		v = v.Elem()
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		return string(b), true, err
+	}
+	if v.CanAddr() {
+		if m, ok := v.Addr().Interface().(encoding.TextMarshaler); ok {
+			b, err := m.MarshalText()
+			return string(b), true, err
+		}
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true, nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), true, nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), true, nil
+	}
+	return "", false, fmt.Errorf("cannot write %s as text", v.Type())
+}
+
+// nestedAttrs returns the attributes held by the fields of v.
+func nestedAttrs(v reflect.Value) ([]xml.Attr, error) {
+	var attrs []xml.Attr
+	for i := 0; i < v.NumField(); i++ {
+		f, fv := v.Type().Field(i), v.Field(i)
+		name, options := xmlTag(f)
+		switch {
+		case !hasOption(options, "attr"):
+			continue
+		case hasOption(options, "any"):
+			attrs = append(attrs, fv.Interface().([]xml.Attr)...)
+			continue
+		case hasOption(options, "omitempty") && isEmptyValue(fv):
+			continue
+		}
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		m, ok := fv.Interface().(xml.MarshalerAttr)
+		if !ok && fv.CanAddr() {
+			m, ok = fv.Addr().Interface().(xml.MarshalerAttr)
+		}
+		if ok {
+			attr, err := m.MarshalXMLAttr(name)
+			if err != nil {
+				return nil, err
+			}
+			if attr.Name.Local != "" {
+				attrs = append(attrs, attr)
+			}
+			continue
+		}
+		text, ok, err := textOf(fv)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			attrs = append(attrs, xml.Attr{Name: name, Value: text})
+		}
+	}
+	return attrs, nil
+}
+
+// encodeNested writes x as the element start. The children leading back
+// to x go on a stack; the others are written by encoding/xml.
+func encodeNested(e *xml.Encoder, start xml.StartElement, x nestedElement) error {
+	type element struct {
+		v           reflect.Value
+		end         xml.EndElement
+		field, item int
+	}
+	var open []*element
+	write := func(v reflect.Value, start xml.StartElement) error {
+		attrs, err := nestedAttrs(v)
+		if err != nil {
+			return err
+		}
+		start.Attr = append(start.Attr[:len(start.Attr):len(start.Attr)], attrs...)
+		open = append(open, &element{v: v, end: start.End()})
+		return e.EncodeToken(start)
+	}
+	if err := write(reflect.ValueOf(x).Elem(), start); err != nil {
+		return err
+	}
+	for len(open) > 0 {
+		top := open[len(open)-1]
+		if top.field == top.v.NumField() {
+			open = open[:len(open)-1]
+			if err := e.EncodeToken(top.end); err != nil {
+				return err
+			}
+			continue
+		}
+		f, fv := top.v.Type().Field(top.field), top.v.Field(top.field)
+		name, options := xmlTag(f)
+		mixed := hasOption(options, "any") && f.Type.Kind() == reflect.Slice && f.Type.Elem().Implements(mixedNodeType)
+		if !isNested(f.Type) && !mixed {
+			top.field++
+			var err error
+			switch {
+			case f.Name == "XMLName" || f.Tag.Get("xml") == "-" || hasOption(options, "attr") || hasOption(options, "innerxml"):
+			case hasOption(options, "chardata"):
+				var text string
+				var ok bool
+				if text, ok, err = textOf(fv); ok {
+					err = e.EncodeToken(xml.CharData(text))
+				}
+			case hasOption(options, "any"):
+				for i := 0; i < fv.Len() && err == nil; i++ {
+					err = e.Encode(fv.Index(i).Addr().Interface())
+				}
+			case hasOption(options, "omitempty") && isEmptyValue(fv):
+			default:
+				err = e.EncodeElement(fv.Addr().Interface(), xml.StartElement{Name: name})
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		child := fv
+		if fv.Kind() == reflect.Slice {
+			if top.item == fv.Len() {
+				top.field++
+				top.item = 0
+				continue
+			}
+			child = fv.Index(top.item)
+			top.item++
+		} else {
+			top.field++
+		}
+		if mixed {
+			element, elementName := child.Interface().(mixedNode).element()
+			if _, ok := element.(nestedElement); !ok {
+				if err := e.Encode(child.Addr().Interface()); err != nil {
+					return err
+				}
+				continue
+			}
+			child, name = reflect.ValueOf(element), elementName
+		} else if child.IsNil() {
+			continue
+		} else if xmlName := child.Elem().FieldByName("XMLName"); xmlName.IsValid() && xmlName.Interface().(xml.Name).Local != "" {
+			name = xmlName.Interface().(xml.Name)
+		}
+		if err := write(child.Elem(), xml.StartElement{Name: name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonTag returns the JSON name of f, whether it is omitempty, and
+// whether it is left out.
+func jsonTag(f reflect.StructField) (string, bool, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" || f.PkgPath != "" {
+		return "", false, true
+	}
+	name, options := tag, ""
+	if i := strings.Index(tag, ","); i >= 0 {
+		name, options = tag[:i], tag[i:]
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return name, hasOption(options, "omitempty"), false
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+var holdsNestedTypes = make(map[reflect.Type]bool)
+
+// holdsNested reports whether values of t hold nested elements, and are
+// written by marshalNestedJson rather than by encoding/json.
+func holdsNested(t reflect.Type) bool {
+	held, ok := holdsNestedTypes[t]
+	if !ok {
+		held = reachesNested(t, make(map[reflect.Type]bool))
+		holdsNestedTypes[t] = held
+	}
+	return held
+}
+
+func reachesNested(t reflect.Type, seen map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return false
+	}
+	if reflect.PtrTo(t).Implements(nestedElementType) {
+		return true
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		return false
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		if reachesNested(t.Field(i).Type, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNestedJson writes item to w as json.MarshalIndent does. The values
+// holding nested elements go on a stack; the others are written by
+// encoding/json, which refuses to nest deeper than 10000 levels.
+func writeNestedJson(w *bufio.Writer, item interface{}) error {
+	type value struct {
+		v     reflect.Value
+		next  int
+		wrote bool
+	}
+	var open []*value
+	spaces := " "
+	indent := func() string {
+		for len(spaces) < len(open) {
+			spaces += spaces
+		}
+		return spaces[:len(open)]
+	}
+	write := func(v reflect.Value) error {
+		if !holdsNested(v.Type()) {
+			if v.CanAddr() {
+				v = v.Addr()
+			}
+			out, err := json.MarshalIndent(v.Interface(), "", " ")
+			if err != nil {
+				return err
+			}
+			for _, line := range bytes.SplitAfter(out, []byte("\n")) {
+				w.Write(line)
+				if len(line) > 0 && line[len(line)-1] == '\n' {
+					w.WriteString(indent())
+				}
+			}
+			return nil
+		}
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				w.WriteString("null")
+				return nil
+			}
+			v = v.Elem()
+		}
+		switch {
+		case v.Kind() == reflect.Struct:
+			w.WriteByte('{')
+		case v.IsNil():
+			w.WriteString("null")
+			return nil
+		default:
+			w.WriteByte('[')
+		}
+		open = append(open, &value{v: v})
+		return nil
+	}
+	if err := write(reflect.ValueOf(item)); err != nil {
+		return err
+	}
+	for len(open) > 0 {
+		top := open[len(open)-1]
+		var next reflect.Value
+		key := ""
+		if top.v.Kind() == reflect.Slice {
+			if top.next < top.v.Len() {
+				next = top.v.Index(top.next)
+			}
+		} else {
+			for ; top.next < top.v.NumField(); top.next++ {
+				name, omitEmpty, skip := jsonTag(top.v.Type().Field(top.next))
+				if !skip && !(omitEmpty && isEmptyValue(top.v.Field(top.next))) {
+					next = top.v.Field(top.next)
+					quoted, _ := json.Marshal(name)
+					key = string(quoted) + ": "
+					break
+				}
+			}
+		}
+		if !next.IsValid() {
+			open = open[:len(open)-1]
+			if top.wrote {
+				w.WriteByte('\n')
+				w.WriteString(indent())
+			}
+			if top.v.Kind() == reflect.Slice {
+				w.WriteByte(']')
+			} else {
+				w.WriteByte('}')
+			}
+			continue
+		}
+		if top.wrote {
+			w.WriteByte(',')
+		}
+		top.wrote = true
+		top.next++
+		w.WriteByte('\n')
+		w.WriteString(indent())
+		w.WriteString(key)
+		if err := write(next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+{{end}}// contentModels holds, by node key, a regular expression the keys of the
+// children of an element, each followed by a space, must match.
+var contentModels = map[string]*regexp.Regexp{ {{range .ContentModels}}
+	{{printf "%q" .Key}}: regexp.MustCompile({{printf "%q" .Pattern}}),{{end}}
+}
+
+// contentModelTexts holds the content models of contentModels as written
+// in a DTD.
+var contentModelTexts = map[string]string{ {{range .ContentModels}}
+	{{printf "%q" .Key}}: {{printf "%q" .Model}},{{end}}
+}
+
+// contentKeying tells same-named elements apart: by name, parent or path.
+const contentKeying = "{{.Keying}}"
+
+// contentElement is an element being validated.
+type contentElement struct {
+	name, localKey, key string
+	line, column        int
+	// children holds the keys of its children, each followed by a space,
+	// and names their names.
+	children strings.Builder
+	names    []string
+}
+
+// validateContent reads the XML of decoder and writes where each element
+// whose children do not match its content model starts, returning how
+// many do not.
+func validateContent(decoder *xml.Decoder) int {
+	invalid := 0
+	var open []*contentElement
+	for {
+		line, column := decoder.InputPos()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			e := &contentElement{name: t.Name.Local, localKey: t.Name.Space + "___" + t.Name.Local, line: line, column: column}
+			e.key = e.localKey
+			if len(open) > 0 {
+				parent := open[len(open)-1]
+				parent.children.WriteString(e.localKey + " ")
+				parent.names = append(parent.names, e.name)
+				switch contentKeying {
+				case "parent":
+					e.key = parent.localKey + "/" + e.localKey
+				case "path":
+					e.key = parent.key + "/" + e.localKey
+				}
+			}
+			open = append(open, e)
+		case xml.EndElement:
+			e := open[len(open)-1]
+			open = open[:len(open)-1]
+			if model, ok := contentModels[e.key]; ok && !model.MatchString(e.children.String()) {
+				invalid += 1
+				fmt.Printf("%s:%d:%d: %s: children (%s) do not match %s\n", filename, e.line, e.column, e.name, strings.Join(e.names, ", "), contentModelTexts[e.key])
+			}
+		}
 	}
-	os.Stdout.Write(output)
+	return invalid
 }
 
 func genericReader(filename string) (io.Reader, *os.File, error) {
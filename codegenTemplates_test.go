@@ -0,0 +1,235 @@
+package chidleystein
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// spewStub stands in for the spew package the converter imports, so that
+// it builds without the network.
+const spewStub = `package spew
+
+import (
+	"fmt"
+	"io"
+)
+
+type ConfigState struct {
+	Indent                  string
+	DisableCapacities       bool
+	DisablePointerAddresses bool
+}
+
+func (c ConfigState) Fdump(w io.Writer, a ...interface{}) { fmt.Fprintf(w, "%+v\n", a...) }
+`
+
+// buildConverter builds the converter WriteGoConverter writes for sample
+// and returns the path of the program.
+func buildConverter(t *testing.T, sample string, opts Options) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("builds the generated converter")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go tool")
+	}
+	var b bytes.Buffer
+	if err := inferString(t, sample, opts).WriteGoConverter(&b, "sample.xml"); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.go":           b.String(),
+		"go.mod":            "module converter\n\ngo 1.18\n\nrequire github.com/mattetti/go-spew v0.0.0\n\nreplace github.com/mattetti/go-spew => ./spew\n",
+		"spew/go.mod":       "module github.com/mattetti/go-spew\n\ngo 1.18\n",
+		"spew/spew/spew.go": spewStub,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(goTool, "build", "-o", "converter", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building the converter: %v\n%s", err, out)
+	}
+	return filepath.Join(dir, "converter")
+}
+
+// unindent keeps what is written to it without newlines and the spaces
+// starting each line, so that deeply indented JSON stays small.
+type unindent struct {
+	b         bytes.Buffer
+	lineStart bool
+}
+
+func (u *unindent) Write(p []byte) (int, error) {
+	for _, c := range p {
+		switch {
+		case c == '\n':
+			u.lineStart = true
+		case c == ' ' && u.lineStart:
+		default:
+			u.lineStart = false
+			u.b.WriteByte(c)
+		}
+	}
+	return len(p), nil
+}
+
+func TestConverterRoundTrip(t *testing.T) {
+	const depth = 11000
+	type run struct {
+		flag  string
+		input string
+		want  string
+		// unindent compares the output without newlines and indentation.
+		unindent bool
+		fails    bool
+	}
+	tests := []struct {
+		name    string
+		sample  string
+		options func(*Options)
+		runs    []run
+	}{
+		{
+			name:    "whitespace",
+			sample:  `<doc><n xml:space="preserve"> 5 </n><m xml:space="preserve">   </m><k> 7 </k></doc>`,
+			options: func(o *Options) { o.UseType = true },
+			runs: []run{
+				{flag: "-x", want: "  <doc>\n      <n xml:space=\"preserve\"> 5 </n>\n      <m xml:space=\"preserve\">   </m>\n      <k>7</k>\n  </doc>"},
+				{flag: "-j", want: `{"n": {"Attr_space": "preserve","Text": " 5 "},"m": {"Attr_space": "preserve","Text": "   "},"k": {"Text": 7}}`, unindent: true},
+			},
+		},
+		{
+			name:   "mixed content",
+			sample: `<doc><p k="a">H<sub>2</sub>O is <i>wet</i></p><p>plain</p></doc>`,
+			runs: []run{
+				{flag: "-x", want: `<doc><p k="a">H<sub>2</sub>O is <i>wet</i></p><p>plain</p></doc>`},
+				{flag: "-j", want: `{"p": [{"Attr_k": "a","nodes": [{"text": "H"},{"sub": {"Text": "2"}},{"text": "O is "},{"i": {"Text": "wet"}}]},{"nodes": [{"text": "plain"}]}]}`, unindent: true},
+			},
+		},
+		{
+			name:    "mixed content as inner XML",
+			sample:  `<doc><p k="a">H<sub>2</sub>O is <i>wet</i></p><p>plain</p></doc>`,
+			options: func(o *Options) { o.MixedContent = MixedInnerXML },
+			runs: []run{
+				{flag: "-x", want: `<doc><p k="a">H<sub>2</sub>O is <i>wet</i></p><p>plain</p></doc>`},
+			},
+		},
+		{
+			name:    "catch-all",
+			sample:  `<doc a="1"><x>1</x></doc>`,
+			options: func(o *Options) { o.CatchAllElements = map[string]bool{"doc": true} },
+			runs: []run{
+				{flag: "-x", input: `<doc a="1" b="2"><x>1</x><y>z<w/></y></doc>`, want: "  <doc a=\"1\" b=\"2\">\n      <x>1</x>\n      <y>z<w/></y>\n  </doc>"},
+				{flag: "-u", input: `<doc a="1" b="2"><x>1</x><y>z<w/></y></doc>`, want: "1 doc/y\n1 doc@b\n"},
+			},
+		},
+		{
+			name:   "content model",
+			sample: `<doc><a>1</a><b>2</b></doc>`,
+			runs: []run{
+				{flag: "-V"},
+				{flag: "-V", input: `<doc><b>2</b><a>1</a></doc>`, fails: true},
+			},
+		},
+		{
+			name:   "recursion",
+			sample: `<doc><s><s><t>x</t></s></s></doc>`,
+			runs: []run{
+				{flag: "-x", want: "  <doc>\n      <s>\n          <s>\n              <t>x</t>\n          </s>\n      </s>\n  </doc>"},
+				{
+					flag:     "-j",
+					input:    "<doc>" + strings.Repeat("<s>", depth) + "<t>x</t>" + strings.Repeat("</s>", depth) + "</doc>",
+					want:     strings.Repeat(`{"s": `, depth) + `{"t": {"Text": "x"}}` + strings.Repeat("}", depth),
+					unindent: true,
+				},
+				{flag: "-j", input: "<doc><s><s><t>x</t></s>", fails: true},
+			},
+		},
+		{
+			name:    "recursion with a float JSON cannot hold",
+			sample:  `<doc><s><s><v>1.5</v></s></s></doc>`,
+			options: func(o *Options) { o.UseType = true },
+			runs: []run{
+				{flag: "-j", input: `<doc><s><v>NaN</v></s></doc>`, fails: true},
+			},
+		},
+		{
+			name:   "recursive mixed content",
+			sample: `<doc><p>a <i>b <i>c</i></i></p></doc>`,
+			runs: []run{
+				{
+					flag:  "-x",
+					input: "<doc><p>" + strings.Repeat("<i>a ", depth) + strings.Repeat("</i>", depth) + "</p></doc>",
+					want:  "<doc><p>" + strings.Repeat("<i>a ", depth) + strings.Repeat("</i>", depth) + "</p></doc>",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			if tt.options != nil {
+				tt.options(&opts)
+			}
+			converter := buildConverter(t, tt.sample, opts)
+			for _, r := range tt.runs {
+				input := r.input
+				if input == "" {
+					input = tt.sample
+				}
+				file := filepath.Join(t.TempDir(), "input.xml")
+				if err := os.WriteFile(file, []byte(input), 0644); err != nil {
+					t.Fatal(err)
+				}
+				var out bytes.Buffer
+				var stdout io.Writer = &out
+				u := &unindent{}
+				if r.unindent {
+					stdout = u
+				}
+				var stderr bytes.Buffer
+				cmd := exec.Command(converter, r.flag, "-f", file)
+				cmd.Stdout, cmd.Stderr = stdout, &stderr
+				err := cmd.Run()
+				if r.fails {
+					if err == nil {
+						t.Errorf("%s: no error", r.flag)
+					} else if strings.Contains(stderr.String(), "panic:") {
+						t.Errorf("%s: panicked:\n%s", r.flag, stderr.String())
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("%s: %v\n%s", r.flag, err, stderr.String())
+					continue
+				}
+				got := out.String()
+				if r.unindent {
+					got = u.b.String()
+				}
+				if got != r.want {
+					if len(got) > 500 {
+						got = got[:500] + "..."
+					}
+					t.Errorf("%s: got\n%s\nwant\n%s", r.flag, got, r.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package chidleystein
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Particle is one part of the content model of an element: a child
+// element, or a choice between child elements, seen MinOccurs to
+// MaxOccurs times in a row.
+type Particle struct {
+	// Child is the element, or nil for a choice.
+	Child *Node
+	// Choice holds the alternatives of a choice.
+	Choice    []*Particle
+	MinOccurs int
+	MaxOccurs int
+}
+
+// ContentModel returns the sequence of particles the children of n were
+// seen in. Children seen in both orders of each other, or again after
+// another child, are a repeated choice between them; adjacent children
+// never seen in the same instance of n are a choice.
+func (n *Node) ContentModel() []*Particle {
+	keys := n.childKeysByRank()
+	var particles []*Particle
+	for _, component := range n.orderedComponents(keys) {
+		if len(component) == 1 {
+			child := n.Children[component[0]]
+			minOccurs, maxOccurs := n.ChildOccurs(child)
+			particles = append(particles, &Particle{Child: child, MinOccurs: minOccurs, MaxOccurs: maxOccurs})
+			continue
+		}
+		choice := &Particle{}
+		for _, key := range component {
+			child := n.Children[key]
+			if minOccurs, _ := n.ChildOccurs(child); minOccurs > 0 {
+				choice.MinOccurs = 1
+			}
+			choice.MaxOccurs += n.occurs[key].max
+			choice.Choice = append(choice.Choice, &Particle{Child: child, MinOccurs: 1, MaxOccurs: 1})
+		}
+		particles = append(particles, choice)
+	}
+	return n.groupChoices(particles)
+}
+
+// childKeysByRank returns the keys of the children of n in the order
+// they were first seen.
+func (n *Node) childKeysByRank() []string {
+	keys := make([]string, 0, len(n.Children))
+	for key := range n.Children {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := n.rank(keys[i]), n.rank(keys[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func (n *Node) rank(key string) int {
+	if o, ok := n.occurs[key]; ok {
+		return o.rank
+	}
+	return 0
+}
+
+// precedes reports whether the child of key a was seen before that of b
+// in some instance of n.
+func (n *Node) precedes(a, b string) bool {
+	o, ok := n.occurs[a]
+	return ok && o.precedes[b]
+}
+
+// orderedComponents splits keys into the groups of children seen in both
+// orders of each other, directly or through others, and returns them in
+// an order agreeing with every instance of n; where that leaves a choice,
+// the group first seen goes first. keys is in rank order, and so is each
+// group.
+func (n *Node) orderedComponents(keys []string) [][]string {
+	// Tarjan's algorithm finds the strongly connected components of
+	// the precedes graph.
+	index := make(map[string]int, len(keys))
+	low := make(map[string]int, len(keys))
+	onStack := make(map[string]bool, len(keys))
+	var stack []string
+	var components [][]string
+	var connect func(key string)
+	connect = func(key string) {
+		index[key] = len(index)
+		low[key] = index[key]
+		stack = append(stack, key)
+		onStack[key] = true
+		for _, next := range keys {
+			if next == key || !n.precedes(key, next) {
+				continue
+			}
+			if _, ok := index[next]; !ok {
+				connect(next)
+				if low[next] < low[key] {
+					low[key] = low[next]
+				}
+			} else if onStack[next] && index[next] < low[key] {
+				low[key] = index[next]
+			}
+		}
+		if low[key] == index[key] {
+			var component []string
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == key {
+					break
+				}
+			}
+			components = append(components, component)
+		}
+	}
+	for _, key := range keys {
+		if _, ok := index[key]; !ok {
+			connect(key)
+		}
+	}
+
+	position := make(map[string]int, len(keys))
+	for i, key := range keys {
+		position[key] = i
+	}
+	componentOf := make(map[string]int, len(keys))
+	for c, component := range components {
+		sort.Slice(component, func(i, j int) bool {
+			return position[component[i]] < position[component[j]]
+		})
+		for _, key := range component {
+			componentOf[key] = c
+		}
+	}
+
+	// Kahn's algorithm orders them, taking the first seen of those
+	// free to go next, then those free never seen with it, which may
+	// make a choice.
+	before := make([]int, len(components))
+	for _, a := range keys {
+		for _, b := range keys {
+			if componentOf[a] != componentOf[b] && n.precedes(a, b) {
+				before[componentOf[b]] += 1
+			}
+		}
+	}
+	done := make([]bool, len(components))
+	ordered := make([][]string, 0, len(components))
+	free := func(c int) bool {
+		return !done[c] && before[c] == 0
+	}
+	place := func(c int) {
+		done[c] = true
+		ordered = append(ordered, components[c])
+		for _, a := range components[c] {
+			for _, b := range keys {
+				if componentOf[b] != c && n.precedes(a, b) {
+					before[componentOf[b]] -= 1
+				}
+			}
+		}
+	}
+	// firstFree returns the first seen free component that ok accepts,
+	// or -1.
+	firstFree := func(ok func(c int) bool) int {
+		next := -1
+		for c, component := range components {
+			if free(c) && ok(c) && (next < 0 || position[component[0]] < position[components[next][0]]) {
+				next = c
+			}
+		}
+		return next
+	}
+	for len(ordered) < len(components) {
+		next := firstFree(func(int) bool { return true })
+		place(next)
+		if len(components[next]) > 1 {
+			continue
+		}
+		batch := []string{components[next][0]}
+		for {
+			next = firstFree(func(c int) bool {
+				return len(components[c]) == 1 && n.excludesAll(batch, components[c][0])
+			})
+			if next < 0 {
+				break
+			}
+			place(next)
+			batch = append(batch, components[next][0])
+		}
+	}
+	return ordered
+}
+
+// excludesAll reports whether the child of key was never seen in an
+// instance of n together with any of those of keys.
+func (n *Node) excludesAll(keys []string, key string) bool {
+	for _, k := range keys {
+		if n.precedes(k, key) || n.precedes(key, k) {
+			return false
+		}
+	}
+	return true
+}
+
+// groupChoices makes a choice of each run of two or more children in
+// particles never seen together in an instance of n.
+func (n *Node) groupChoices(particles []*Particle) []*Particle {
+	var grouped []*Particle
+	for i := 0; i < len(particles); {
+		j := i + 1
+		for j < len(particles) && n.excludes(particles[i:j], particles[j]) {
+			j++
+		}
+		if j-i < 2 {
+			grouped = append(grouped, particles[i])
+			i++
+			continue
+		}
+		choice := &Particle{MaxOccurs: 1}
+		present := 0
+		for _, p := range particles[i:j] {
+			o := n.occurs[p.Child.localKey()]
+			present += o.present
+			choice.Choice = append(choice.Choice, &Particle{Child: p.Child, MinOccurs: o.minPresent, MaxOccurs: o.max})
+		}
+		if present >= n.instances {
+			choice.MinOccurs = 1
+		}
+		grouped = append(grouped, choice)
+		i = j
+	}
+	return grouped
+}
+
+// excludes reports whether the child of p was never seen in an instance
+// of n together with any of those of run. Choices exclude nothing.
+func (n *Node) excludes(run []*Particle, p *Particle) bool {
+	if p.Child == nil {
+		return false
+	}
+	keys := make([]string, 0, len(run))
+	for _, q := range run {
+		if q.Child == nil {
+			return false
+		}
+		keys = append(keys, q.Child.localKey())
+	}
+	return n.excludesAll(keys, p.Child.localKey())
+}
+
+// contentChildren returns the children of n in the order of its content
+// model.
+func (n *Node) contentChildren() []*Node {
+	var children []*Node
+	for _, p := range n.ContentModel() {
+		if p.Child != nil {
+			children = append(children, p.Child)
+		}
+		for _, q := range p.Choice {
+			children = append(children, q.Child)
+		}
+	}
+	return children
+}
+
+// ContentModelString writes particles like a DTD content model, such as
+// (title, author+, (isbn | issn)?); it is empty for no particles.
+func ContentModelString(particles []*Particle) string {
+	if len(particles) == 0 {
+		return ""
+	}
+	parts := make([]string, len(particles))
+	for i, p := range particles {
+		parts[i] = p.String()
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// String writes p like a DTD content particle: the element name or the
+// choice, then ?, * or + for the times it may occur.
+func (p *Particle) String() string {
+	s := ""
+	if p.Child != nil {
+		s = p.Child.Name
+	} else {
+		parts := make([]string, len(p.Choice))
+		for i, q := range p.Choice {
+			parts[i] = q.String()
+		}
+		s = "(" + strings.Join(parts, " | ") + ")"
+	}
+	return s + p.occurrence()
+}
+
+// occurrence returns the DTD occurrence indicator of p: any number of
+// repetitions goes, as in the slice of a struct field.
+func (p *Particle) occurrence() string {
+	switch {
+	case p.MinOccurs == 0 && p.MaxOccurs <= 1:
+		return "?"
+	case p.MinOccurs == 0:
+		return "*"
+	case p.MaxOccurs > 1:
+		return "+"
+	}
+	return ""
+}
+
+// contentModels returns the content models of every element, by node
+// key; an element seen without children has the model ().
+func (s *Schema) contentModels() []*ContentModelInfo {
+	keys := make([]string, 0, len(s.ex.GlobalNodeMap))
+	for key := range s.ex.GlobalNodeMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	models := make([]*ContentModelInfo, 0, len(keys))
+	for _, key := range keys {
+		particles := s.ex.GlobalNodeMap[key].ContentModel()
+		model := ContentModelString(particles)
+		if model == "" {
+			model = "()"
+		}
+		models = append(models, &ContentModelInfo{Key: key, Model: model, Pattern: contentPattern(particles)})
+	}
+	return models
+}
+
+// contentPattern returns a regular expression matching the keys of the
+// children of an element, each followed by a space, that fit particles.
+func contentPattern(particles []*Particle) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, p := range particles {
+		b.WriteString(p.pattern())
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+func (p *Particle) pattern() string {
+	if p.Child != nil {
+		return "(?:" + regexp.QuoteMeta(p.Child.localKey()+" ") + ")" + p.occurrence()
+	}
+	parts := make([]string, len(p.Choice))
+	for i, q := range p.Choice {
+		parts[i] = q.pattern()
+	}
+	return "(?:" + strings.Join(parts, "|") + ")" + p.occurrence()
+}
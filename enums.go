@@ -0,0 +1,156 @@
+package chidleystein
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// countValue counts v among the distinct values of the field, until
+// there are more than limit of them.
+func (nti *NodeTypeInfo) countValue(v string, limit int) {
+	if nti.tooManyValues {
+		return
+	}
+	v = strings.TrimSpace(v)
+	if _, ok := nti.values[v]; !ok && len(nti.values) == limit {
+		nti.tooManyValues = true
+		nti.values = nil
+		return
+	}
+	if nti.values == nil {
+		nti.values = make(map[string]int)
+	}
+	nti.values[v] += 1
+}
+
+// enumValues returns the values of the field, sorted, if they make an
+// enumeration: at most limit distinct values, at least one of which was
+// seen more than once. It returns nil otherwise.
+func (nti *NodeTypeInfo) enumValues(limit int) []string {
+	if limit <= 0 || nti.padded || nti.tooManyValues || len(nti.values) == 0 || len(nti.values) > limit {
+		return nil
+	}
+	repeated := false
+	values := make([]string, 0, len(nti.values))
+	for v, count := range nti.values {
+		values = append(values, v)
+		repeated = repeated || count > 1
+	}
+	if !repeated {
+		return nil
+	}
+	sort.Strings(values)
+	return values
+}
+
+// enumType is a named string type generated for a field taking a few
+// values.
+type enumType struct {
+	name   string
+	values []string
+	// strict makes unmarshaling refuse values not in values.
+	strict bool
+}
+
+// constName returns the name of the constant for value.
+func (e *enumType) constName(value string) string {
+	return e.name + "_" + identifier(value)
+}
+
+// identifier turns s into a Go or Java identifier part, replacing what
+// cannot be in one by _.
+func identifier(s string) string {
+	s = cleanName(s)
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// constNames returns the constant names of the values of e, made unique.
+func (e *enumType) constNames(name func(value string) string) []string {
+	used := make(map[string]bool)
+	names := make([]string, len(e.values))
+	for i, value := range e.values {
+		n := name(value)
+		base := n
+		for j := 2; used[n]; j++ {
+			n = base + "_" + strconv.Itoa(j)
+		}
+		used[n] = true
+		names[i] = n
+	}
+	return names
+}
+
+// printEnumTypes writes the types generated for enums.
+func printEnumTypes(lineChannel chan string, enums map[string]*enumType) {
+	var names []string
+	for name := range enums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lineChannel <- enumSource(enums[name])
+	}
+}
+
+func enumSource(e *enumType) string {
+	var b strings.Builder
+	names := e.constNames(e.constName)
+
+	b.WriteString("// " + e.name + " holds the values seen for a field.\n")
+	b.WriteString("type " + e.name + " string\n\nconst (\n")
+	for i, value := range e.values {
+		b.WriteString("\t" + names[i] + " " + e.name + " = " + strconv.Quote(value) + "\n")
+	}
+	b.WriteString(")\n\n")
+
+	b.WriteString("// Valid reports whether e is one of the values seen.\n")
+	b.WriteString("func (e " + e.name + ") Valid() bool {\n\tswitch e {\n\tcase " + strings.Join(names, ", ") + ":\n\t\treturn true\n\t}\n\treturn false\n}\n")
+	if e.strict {
+		b.WriteString(strings.Replace(strictEnumSource, "NAME", e.name, -1))
+	}
+	return b.String()
+}
+
+const strictEnumSource = `
+func (e *NAME) set(s string) error {
+	v := NAME(strings.TrimSpace(s))
+	if v != "" && !v.Valid() {
+		return fmt.Errorf("invalid NAME %q", s)
+	}
+	*e = v
+	return nil
+}
+
+func (e *NAME) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var s string
+	if err := d.DecodeElement(&s, &start); err != nil {
+		return err
+	}
+	return e.set(s)
+}
+
+func (e *NAME) UnmarshalXMLAttr(attr xml.Attr) error {
+	return e.set(attr.Value)
+}
+
+// UnmarshalText is used by encoding/xml for ,chardata fields.
+func (e *NAME) UnmarshalText(b []byte) error {
+	return e.set(string(b))
+}
+`
+
+// javaEnumConstName returns the Java constant for value.
+func javaEnumConstName(value string) string {
+	name := strings.ToUpper(identifier(value))
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+	return name
+}
@@ -0,0 +1,207 @@
+package chidleystein
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Explain writes, for each element text or attribute matching path, the
+// type inferred with UseType, how often it was seen, sample values, and
+// the value, and where it was read, that ruled out each other type.
+//
+// path is an element path as in WriteTypeReport, such as doc/p/vals, or
+// its end, such as vals; an attribute is path@name. A path longer than
+// the keying keeps apart, such as doc/p/vals keyed by name, is an error:
+// ambiguous if elements were seen along it, unknown otherwise.
+func (s *Schema) Explain(w io.Writer, path string) error {
+	elementPath, attribute := path, ""
+	if i := strings.LastIndex(path, "@"); i >= 0 {
+		elementPath, attribute = path[:i], path[i+1:]
+	}
+	bw := bufio.NewWriter(w)
+	// matched is set if an element matched elementPath, found if it or
+	// its attribute was explained.
+	matched, found := false, false
+	nodes := s.ex.nodesByDiscoveredOrder()
+	for _, n := range nodes {
+		nodePath := strings.Join(append(append([]string{}, n.context...), n.Name), "/")
+		if elementPath != "" && !pathMatches(nodePath, elementPath) {
+			continue
+		}
+		matched = true
+		if attribute == "" {
+			found = true
+			s.explainElement(bw, nodes, n, nodePath)
+			continue
+		}
+		for _, fqn := range s.ex.GlobalTagAttributes[nk(n)] {
+			if fqn.name == attribute {
+				found = true
+				s.explainAttribute(bw, n, fqn, nodePath)
+			}
+		}
+	}
+	if !found {
+		if !matched && s.ex.pathSeen(elementPath) {
+			return fmt.Errorf("chidley: %q is ambiguous: elements are told apart by %s, which keeps no path this long; try -K path", path, s.ex.Keying)
+		}
+		return fmt.Errorf("chidley: no element or attribute %q", path)
+	}
+	return bw.Flush()
+}
+
+// pathMatches reports whether nodePath is path or ends with it.
+func pathMatches(nodePath, path string) bool {
+	return nodePath == path || strings.HasSuffix(nodePath, "/"+path)
+}
+
+// pathSeen reports whether elements were seen along path, each a child of
+// the one before.
+func (ex *Extractor) pathSeen(path string) bool {
+	names := strings.Split(path, "/")
+	var along func(n *Node, names []string) bool
+	along = func(n *Node, names []string) bool {
+		if n.Name != names[0] {
+			return false
+		}
+		if len(names) == 1 {
+			return true
+		}
+		for _, child := range n.Children {
+			if along(child, names[1:]) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, n := range ex.GlobalNodeMap {
+		if along(n, names) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schema) explainElement(w *bufio.Writer, nodes []*Node, n *Node, path string) {
+	nti := n.nodeTypeInfo
+	w.WriteString(path + "\n")
+	w.WriteString("  elements: " + strconv.Itoa(n.Instances()) + "\n")
+	if n.firstAt.known() {
+		w.WriteString("  first seen" + atPosition(n.firstAt) + "\n")
+	}
+	for _, p := range nodes {
+		if containsNode(p, n) {
+			minOccurs, maxOccurs := p.ChildOccurs(n)
+			w.WriteString("  in " + p.Name + ": " + strconv.Itoa(minOccurs) + ".." + strconv.Itoa(maxOccurs) + " per element")
+			if o, ok := p.occurs[n.localKey()]; ok {
+				w.WriteString(", first" + atPosition(o.firstAt))
+			}
+			w.WriteString("\n")
+		}
+	}
+	if model := ContentModelString(n.ContentModel()); model != "" {
+		w.WriteString("  children: " + model + "\n")
+	}
+	if names := s.ex.recursiveWith(s.ex.recursion(), n); names != nil {
+		w.WriteString("  recursive, through " + strings.Join(names, ", ") + "\n")
+	}
+	if n.mixed {
+		w.WriteString("  mixed content, held as " + s.Options.mixedFor(n).String() + "\n")
+	}
+	if !n.hasCharData && nti.count == 0 {
+		w.WriteString("  no text\n")
+		return
+	}
+	s.explainValues(w, textField(n), nti)
+}
+
+func containsNode(p *Node, n *Node) bool {
+	for _, c := range p.Children {
+		if c == n {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schema) explainAttribute(w *bufio.Writer, n *Node, fqn *FQN, path string) {
+	w.WriteString(path + "@" + fqn.name + "\n")
+	w.WriteString("  on " + strconv.Itoa(fqn.present) + " of " + strconv.Itoa(n.Instances()) + " elements\n")
+	if fqn.firstAt.known() {
+		w.WriteString("  first seen" + atPosition(fqn.firstAt) + "\n")
+	}
+	s.explainValues(w, attributeField(n, fqn), fqn.typeInfo)
+}
+
+func (s *Schema) explainValues(w *bufio.Writer, field string, nti *NodeTypeInfo) {
+	w.WriteString("  type: " + s.describeType(nti, field) + "\n")
+	w.WriteString("  values: " + strconv.Itoa(nti.count) + ", empty or nil: " + strconv.Itoa(nti.absent) + "\n")
+	if len(nti.samples) > 0 {
+		quoted := make([]string, len(nti.samples))
+		for i, v := range nti.samples {
+			quoted[i] = strconv.Quote(v)
+		}
+		w.WriteString("  samples: " + strings.Join(quoted, ", ") + "\n")
+	}
+	if nti.example != "" {
+		w.WriteString("  first value: " + strconv.Quote(nti.example) + atPosition(nti.exampleAt) + "\n")
+	}
+	s.explainEvidence(w, "  ", nti)
+	if l := nti.list; l != nil {
+		w.WriteString("  as a list, items:\n")
+		s.explainEvidence(w, "    ", l.items)
+		w.WriteString("  as a list, comma-separated parts:\n")
+		s.explainEvidence(w, "    ", l.parts)
+	}
+}
+
+// explainEvidence writes the types nti was ruled out of, with the values
+// that did it, and those it still fits.
+func (s *Schema) explainEvidence(w *bufio.Writer, indent string, nti *NodeTypeInfo) {
+	var fits []string
+	for _, typeName := range s.typeNames() {
+		v, ok := nti.blocked[typeName]
+		if !ok {
+			fits = append(fits, typeName)
+			continue
+		}
+		w.WriteString(indent + "not " + typeName + ": " + strconv.Quote(v) + atPosition(nti.blockedAt[typeName]) + "\n")
+	}
+	if len(fits) > 0 && nti.example != "" {
+		w.WriteString(indent + "fits: " + strings.Join(fits, ", ") + "\n")
+	}
+}
+
+// describeType names the Go type a field with the values seen by nti
+// gets with UseType, and says what it is when that is not plain.
+func (s *Schema) describeType(nti *NodeTypeInfo, field string) string {
+	policy := s.Options.policyFor(field)
+	t := findType(nti, true, policy, s.Options.TimeLayouts)
+	if t != "string" {
+		if nti.isNullable() {
+			return nullKindOf(t).name + ", a " + t + " that is null when empty"
+		}
+		return t
+	}
+	if nti.example == "" {
+		return "string, no value seen"
+	}
+	if values := nti.enumValues(s.Options.EnumLimit); values != nil {
+		return "string enumeration of " + strconv.Quote(strings.Join(values, ", "))
+	}
+	shape := nti.listShape(policy, s.Options.TimeLayouts, s.Options.EnumLimit)
+	switch {
+	case shape == nil:
+		return t
+	case shape.tupleSize > 0:
+		return "list of tuples of " + strconv.Itoa(shape.tupleSize) + " " + shape.itemType + " separated by commas"
+	case shape.enumValues != nil:
+		return "list of the words " + strconv.Quote(strings.Join(shape.enumValues, ", "))
+	case shape.separator == ",":
+		return "list of " + shape.itemType + " separated by commas"
+	}
+	return "list of " + shape.itemType + " separated by spaces"
+}
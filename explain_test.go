@@ -0,0 +1,73 @@
+package chidleystein
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	const doc = `<doc><p><vals k="1">1 2</vals><n>7</n></p><p><n>x</n></p></doc>`
+	tests := []struct {
+		path    string
+		keying  NodeKeying
+		want    []string
+		wantErr string
+	}{
+		{
+			path: "n",
+			want: []string{
+				"n\n  elements: 2\n",
+				"  in p: 1..1 per element, first at <input>:1:31\n",
+				"  type: string\n",
+				`  samples: "7", "x"`,
+				`  not int8: "x" at <input>:1:46`,
+			},
+		},
+		{
+			path: "vals",
+			want: []string{"  type: list of int8 separated by spaces\n", "  in p: 0..1 per element"},
+		},
+		{
+			path: "vals@k",
+			want: []string{"vals@k\n  on 1 of 1 elements\n", "  type: bool\n"},
+		},
+		{
+			path:   "p/n",
+			keying: KeyByPath,
+			want:   []string{"doc/p/n\n  elements: 2\n"},
+		},
+		{
+			path:   "doc/p/n",
+			keying: KeyByPath,
+			want:   []string{"doc/p/n\n"},
+		},
+		{path: "p/n", wantErr: "ambiguous"},
+		{path: "oc/p/n", keying: KeyByPath, wantErr: "no element or attribute"},
+		{path: "zz", wantErr: "no element or attribute"},
+		{path: "vals@zz", wantErr: "no element or attribute"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.keying.String()+" "+tt.path, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.UseType = true
+			opts.Keying = tt.keying
+			var b bytes.Buffer
+			err := inferString(t, doc, opts).Explain(&b, tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Explain(%q) = %v, want an error with %q", tt.path, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(b.String(), want) {
+					t.Errorf("no %q in:\n%s", want, b.String())
+				}
+			}
+		})
+	}
+}
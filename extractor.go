@@ -1,11 +1,15 @@
 package chidleystein
 
 import (
+	"bytes"
+	"context"
 	"encoding/xml"
+	"errors"
 	"io"
 	"log"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 var nameMapper = map[string]string{
@@ -13,7 +17,9 @@ var nameMapper = map[string]string{
 	".": "_dot_",
 }
 
-var DiscoveredOrder = 0
+// ctxCheckInterval is the number of tokens read between two checks of
+// the context passed to ExtractContext.
+const ctxCheckInterval = 1024
 
 type Extractor struct {
 	GlobalTagAttributes    map[string]([]*FQN)
@@ -25,137 +31,291 @@ type Extractor struct {
 	Reader                 io.Reader
 	Root                   *Node
 	FirstNode              *Node
-	hasStartElements       bool
-	useType                bool
-	progress               bool
+	Debug                  bool
+	Progress               bool
+	Keying                 NodeKeying
+	// SourceName names the input in the positions recorded, e.g. the
+	// file name; it may be empty.
+	SourceName       string
+	TimeLayouts      []string
+	BoolVocabularies []BoolVocabulary
+	Strictness       Strictness
+	EnumLimit        int
+	hasStartElements bool
+	discoveredOrder  int
+	keys             map[xml.Name]string
 }
 
 func (ex *Extractor) Extract() error {
-	ex.GlobalTagAttributes = make(map[string]([]*FQN))
-	ex.GlobalTagAttributesMap = make(map[string]bool)
-	ex.NameSpaceTagMap = make(map[string]string)
-	ex.GlobalNodeMap = make(map[string]*Node)
+	return ex.ExtractContext(context.Background())
+}
 
-	decoder := xml.NewDecoder(ex.Reader)
+// ExtractContext builds the model of ex.Reader, stopping with ctx.Err()
+// if ctx is cancelled before the input is exhausted. Calling it again
+// with a new Reader folds that input into the same model.
+//
+// Tokens are handled as they are decoded, without copying: the decoder
+// only reuses its buffers on the next call to Token.
+func (ex *Extractor) ExtractContext(ctx context.Context) error {
+	if ex.Reader == nil {
+		return errors.New("chidley: Extractor has no Reader")
+	}
+	if ex.GlobalNodeMap == nil {
+		ex.init()
+	}
 
-	ex.Root = new(Node)
-	ex.Root.initialize("root", "", "", nil)
+	decoder := xml.NewDecoder(ex.Reader)
 
 	ex.hasStartElements = false
+	ex.Root.instances += 1
+	h := tokenHandler{
+		ex:       ex,
+		nodes:    []*Node{ex.Root},
+		children: make([]instanceChildren, 1, 16),
+		charData: make([][]byte, 1, 16),
+		nils:     make([]bool, 1, 16),
+		preserve: make([]bool, 1, 16),
+		parents:  make([]bool, 1, 16),
+		starts:   make([]Position, 1, 16),
+		pos:      Position{File: ex.SourceName},
+	}
 
-	tokenChannel := make(chan xml.Token, 100)
-	handleTokensDoneChannel := make(chan bool)
-
-	go handleTokens(tokenChannel, ex, handleTokensDoneChannel)
-
-	for {
+	for n := 0; ; n++ {
+		if n%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		// The end of the previous token is the start of this one.
+		h.pos.Line, h.pos.Column = decoder.InputPos()
+		h.pos.Offset = decoder.InputOffset()
 		token, err := decoder.Token()
 		if err != nil {
-			if err.Error() == "EOF" {
+			if err == io.EOF {
 				// OK
 				break
 			}
-			log.Println(err)
 			return err
 		}
 		if token == nil {
-			log.Println("Empty token")
+			if ex.Debug {
+				log.Println("Empty token")
+			}
 			break
 		}
-		tokenChannel <- xml.CopyToken(token)
+		h.handleToken(token)
 	}
-	close(tokenChannel)
-	_ = <-handleTokensDoneChannel
+	closeNode(ex.Root, &h.children[0])
 	return nil
 }
 
-func handleTokens(tChannel chan xml.Token, ex *Extractor, handleTokensDoneChannel chan bool) {
-	depth := 0
-	thisNode := ex.Root
-	first := true
-	var progressCounter int64 = 0
+func (ex *Extractor) init() {
+	ex.GlobalTagAttributes = make(map[string]([]*FQN))
+	ex.GlobalTagAttributesMap = make(map[string]bool)
+	ex.NameSpaceTagMap = make(map[string]string)
+	ex.GlobalNodeMap = make(map[string]*Node)
+	ex.keys = make(map[xml.Name]string)
 
-	for token := range tChannel {
-		switch element := token.(type) {
-		case xml.Comment:
-			if DEBUG {
-				log.Print(thisNode.Name)
-				log.Printf("Comment: %+v\n", string(element))
-			}
+	ex.Root = new(Node)
+	ex.Root.initialize("root", "", "", nil)
+	ex.Root.key = rootKey
+}
 
-		case xml.ProcInst:
-			if DEBUG {
-				log.Println("ProcInst: Target=" + element.Target + "  Inst=[" + string(element.Inst) + "]")
-			}
+// rootKey is the key of Extractor.Root. It sorts next to the key of a
+// <root> element but, holding a space, can never be equal to it.
+const rootKey = "___root "
+
+// tokenHandler holds the state of one pass over the tokens of an input.
+type tokenHandler struct {
+	ex *Extractor
+	// nodes are the open elements; nodes[0] is ex.Root.
+	nodes []*Node
+	// charData[i] collects the text of nodes[i]. The buffers are
+	// reused from one element to the next.
+	charData [][]byte
+	// nils[i] is set if nodes[i] has xsi:nil="true".
+	nils []bool
+	// preserve[i] is set if the whitespace in nodes[i] is significant,
+	// under xml:space="preserve", and parents[i] once nodes[i] has a
+	// child element.
+	preserve []bool
+	parents  []bool
+	// starts[i] is where nodes[i] starts, and pos where the token being
+	// handled does.
+	starts []Position
+	pos    Position
+	// children[i] counts the children of nodes[i]. An element may hold
+	// one of the same node, so the counts cannot live in the node.
+	children []instanceChildren
+	// comments are the XML comments read since the last tag or text;
+	// they document the element that follows, if it is new.
+	comments        []string
+	progressCounter int64
+}
 
-		case xml.Directive:
-			if DEBUG {
-				log.Printf("Directive: %+v\n", string(element))
-			}
+func (h *tokenHandler) handleToken(token xml.Token) {
+	ex := h.ex
+	thisNode := h.nodes[len(h.nodes)-1]
 
-		case xml.StartElement:
-			progressCounter += 1
-			if DEBUG {
-				log.Printf("StartElement: %+v\n", element)
-			}
-			ex.hasStartElements = true
+	switch element := token.(type) {
+	case xml.Comment:
+		if ex.Debug {
+			log.Print(thisNode.Name)
+			log.Printf("Comment: %+v\n", string(element))
+		}
+		if isDocComment(element) {
+			h.comments = append(h.comments, strings.TrimSpace(string(element)))
+		}
 
-			if element.Name.Local == "" {
-				continue
-			}
-			thisNode = ex.handleStartElement(element, thisNode)
-			thisNode.tempCharData = ""
-			if first {
-				first = false
-				ex.FirstNode = thisNode
-			}
-			depth += 1
-			if progress {
-				if progressCounter%50000 == 0 {
-					log.Print(progressCounter)
-				}
-			}
+	case xml.ProcInst:
+		if ex.Debug {
+			log.Println("ProcInst: Target=" + element.Target + "  Inst=[" + string(element.Inst) + "]")
+		}
 
-		case xml.CharData:
-			if DEBUG {
-				log.Print(thisNode.Name)
-				log.Printf("CharData: [%+v]\n", string(element))
+	case xml.Directive:
+		if ex.Debug {
+			log.Printf("Directive: %+v\n", string(element))
+		}
+
+	case xml.StartElement:
+		h.progressCounter += 1
+		if ex.Debug {
+			log.Printf("StartElement: %+v\n", element)
+		}
+		ex.hasStartElements = true
+
+		if element.Name.Local == "" {
+			return
+		}
+		thisNode = ex.handleStartElement(element, thisNode, &h.children[len(h.nodes)-1], &h.pos)
+		if thisNode.instances == 1 && len(h.comments) > 0 {
+			thisNode.comments = h.comments
+		}
+		h.comments = nil
+		h.nodes = append(h.nodes, thisNode)
+		depth := len(h.nodes) - 1
+		h.parents[depth-1] = true
+		preserve := xmlSpacePreserve(element.Attr, h.preserve[depth-1])
+		if depth < len(h.charData) {
+			h.charData[depth] = h.charData[depth][:0]
+			h.nils[depth] = isNil(element.Attr)
+			h.starts[depth] = h.pos
+			h.preserve[depth] = preserve
+			h.parents[depth] = false
+		} else {
+			h.charData = append(h.charData, nil)
+			h.nils = append(h.nils, isNil(element.Attr))
+			h.starts = append(h.starts, h.pos)
+			h.preserve = append(h.preserve, preserve)
+			h.parents = append(h.parents, false)
+			h.children = append(h.children, instanceChildren{})
+		}
+		if ex.FirstNode == nil {
+			ex.FirstNode = thisNode
+		}
+		if ex.Progress {
+			if h.progressCounter%50000 == 0 {
+				log.Print(h.progressCounter)
 			}
+		}
 
-			//if !thisNode.hasCharData {
-			thisNode.tempCharData += strings.TrimSpace(string(element))
-		//}
+	case xml.CharData:
+		if ex.Debug {
+			log.Print(thisNode.Name)
+			log.Printf("CharData: [%+v]\n", string(element))
+		}
+		depth := len(h.nodes) - 1
+		if len(h.comments) > 0 && len(bytes.TrimSpace(element)) > 0 {
+			h.comments = nil
+		}
+		// All of the text is kept: a comment, CDATA section or entity
+		// splits it, and its whitespace may be significant.
+		h.charData[depth] = append(h.charData[depth], element...)
+
+	case xml.EndElement:
+		h.comments = nil
+		depth := len(h.nodes) - 1
+		if element.Name.Local == "" || depth == 0 {
+			return
+		}
+		text := h.charData[depth]
+		charData := string(bytes.TrimSpace(text))
+		// Text between children is mixed content; so is whitespace
+		// where it is significant.
+		if h.parents[depth] && (len(charData) > 0 || h.preserve[depth] && len(text) > 0) {
+			thisNode.mixed = true
+		}
+		// Whitespace around the text of an element without children
+		// under xml:space="preserve" is part of the value.
+		if h.preserve[depth] && !h.parents[depth] && len(charData) < len(text) {
+			thisNode.nodeTypeInfo.padded = true
+			thisNode.hasCharData = true
+		}
+		// Empty text and xsi:nil="true" say the value is missing, not
+		// that it is a string.
+		if h.nils[depth] || len(charData) == 0 {
+			thisNode.nodeTypeInfo.absent += 1
+		} else {
+			thisNode.nodeTypeInfo.checkValue(charData, ex.Strictness, ex.EnumLimit, &h.starts[depth])
+		}
 
-		case xml.EndElement:
-			thisNode.nodeTypeInfo.checkFieldType(thisNode.tempCharData)
+		if ex.Debug {
+			log.Printf("EndElement: %+v\n", element)
+			log.Printf("[[" + charData + "]]")
+			log.Printf("Char is empty: %t", isJustSpacesAndLinefeeds(charData))
+		}
+		if !thisNode.hasCharData && !isJustSpacesAndLinefeeds(charData) {
+			thisNode.hasCharData = true
+		}
 
-			if DEBUG {
-				log.Printf("EndElement: %+v\n", element)
-				log.Printf("[[" + thisNode.tempCharData + "]]")
-				log.Printf("Char is empty: ", isJustSpacesAndLinefeeds(thisNode.tempCharData))
-			}
-			if !thisNode.hasCharData && !isJustSpacesAndLinefeeds(thisNode.tempCharData) {
-				thisNode.hasCharData = true
+		closeNode(thisNode, &h.children[depth])
+		h.nodes = h.nodes[:depth]
+	}
+}
 
-			} else {
+// instanceChildren counts the children of an element being read.
+type instanceChildren struct {
+	counts map[string]int
+	// order lists the children in the order first seen, and last is the
+	// last one.
+	order []string
+	last  string
+}
 
+// add counts the child of localKey, which starts in c, an instance of
+// n, and records that the children seen before it there precede it. A
+// child repeated right after itself precedes nothing.
+func (c *instanceChildren) add(n *Node, localKey string) {
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	if localKey != c.last {
+		for _, seen := range c.order {
+			if seen != localKey {
+				n.occurs[seen].precede(localKey)
 			}
-			thisNode.tempCharData = ""
-			depth -= 1
-
-			for key, c := range thisNode.childCount {
-				if c > 1 {
-					thisNode.Children[key].repeats = true
-				}
-				thisNode.childCount[key] = 0
-			}
-			if thisNode.peekParent() != nil {
-				thisNode = thisNode.popParent()
-			}
 		}
+		if c.counts[localKey] == 0 {
+			c.order = append(c.order, localKey)
+		}
+		c.last = localKey
+	}
+	c.counts[localKey] += 1
+}
+
+// closeNode records the children counted in c, the instance of n that
+// just ended, and resets c for the next element at its depth.
+func closeNode(n *Node, c *instanceChildren) {
+	for _, key := range c.order {
+		count := c.counts[key]
+		if count > 1 {
+			n.Children[key].repeats = true
+		}
+		n.occurs[key].add(count)
+		delete(c.counts, key)
 	}
-	handleTokensDoneChannel <- true
-	close(handleTokensDoneChannel)
+	c.order = c.order[:0]
+	c.last = ""
 }
 
 func space(n int) string {
@@ -176,58 +336,131 @@ func (ex *Extractor) findNewNameSpaces(attrs []xml.Attr) {
 
 var full struct{}
 
-func (ex *Extractor) handleStartElement(startElement xml.StartElement, thisNode *Node) *Node {
+// handleStartElement records startElement, read at at, as a child of
+// thisNode, counted in children, and returns its node.
+func (ex *Extractor) handleStartElement(startElement xml.StartElement, thisNode *Node, children *instanceChildren, at *Position) *Node {
 	name := startElement.Name.Local
 	space := startElement.Name.Space
 
 	ex.findNewNameSpaces(startElement.Attr)
 
-	var child *Node
-	var attributes []*FQN
-	key := nks(space, name)
-
-	child, ok := thisNode.Children[key]
-	// Does thisNode node already exist as child
-	//fmt.Println(space, name)
-	if ok {
-		thisNode.childCount[key] += 1
-		attributes, ok = ex.GlobalTagAttributes[key]
-	} else {
+	localKey := ex.nodeKey(startElement.Name)
+
+	child, ok := thisNode.Children[localKey]
+	if !ok {
 		// if thisNode node does not already exist as child, it may still exist as child on other node:
+		key := ex.childKey(thisNode, localKey)
 		child, ok = ex.GlobalNodeMap[key]
 		if !ok {
 			child = new(Node)
-			DiscoveredOrder += 1
-			child.DiscoveredOrder = DiscoveredOrder
+			ex.discoveredOrder += 1
+			child.DiscoveredOrder = ex.discoveredOrder
 			ex.GlobalNodeMap[key] = child
 			spaceTag, _ := ex.NameSpaceTagMap[space]
 			child.initialize(name, space, spaceTag, thisNode)
-			thisNode.childCount[key] = 1
+			child.firstAt = *at
+			child.nodeTypeInfo.addLayouts(ex.TimeLayouts)
+			child.nodeTypeInfo.addBoolVocabularies(ex.BoolVocabularies)
+			child.key = key
+			child.context = ex.childContext(thisNode)
 
-			attributes = make([]*FQN, 0, 2)
-			ex.GlobalTagAttributes[key] = attributes
-		} else {
-			attributes = ex.GlobalTagAttributes[key]
+			ex.GlobalTagAttributes[key] = make([]*FQN, 0, 2)
+		}
+		thisNode.Children[localKey] = child
+		if _, ok := thisNode.occurs[localKey]; !ok {
+			thisNode.occurs[localKey] = &occurs{firstAt: *at, rank: len(thisNode.occurs)}
 		}
-		thisNode.Children[key] = child
 	}
-	child.pushParent(thisNode)
+	children.add(thisNode, localKey)
+	child.instances += 1
 
 	for _, attr := range startElement.Attr {
-		bigKey := key + "_" + attr.Name.Space + "_" + attr.Name.Local
-		_, ok := ex.GlobalTagAttributesMap[bigKey]
-		if !ok {
-			fqn := new(FQN)
-			fqn.name = attr.Name.Local
-			fqn.space = attr.Name.Space
-			attributes = append(attributes, fqn)
-			ex.GlobalTagAttributesMap[bigKey] = true
+		if isNameSpaceDeclaration(attr.Name) {
+			// The encoder declares the namespaces it writes itself.
+			continue
+		}
+		fqn := ex.addAttribute(child.key, child, attr.Name)
+		fqn.firstAt.keepFirst(*at)
+		fqn.present += 1
+		if strings.TrimSpace(attr.Value) == "" {
+			fqn.typeInfo.absent += 1
+		} else {
+			fqn.typeInfo.checkValue(attr.Value, ex.Strictness, ex.EnumLimit, at)
 		}
 	}
-	ex.GlobalTagAttributes[key] = attributes
 	return child
 }
 
+// nodeKey returns nks(name.Space, name.Local), building each distinct key
+// only once.
+func (ex *Extractor) nodeKey(name xml.Name) string {
+	key, ok := ex.keys[name]
+	if !ok {
+		key = nks(name.Space, name.Local)
+		ex.keys[name] = key
+	}
+	return key
+}
+
+// addAttribute records attribute name on the node n stored under key,
+// and returns its FQN.
+func (ex *Extractor) addAttribute(key string, n *Node, name xml.Name) *FQN {
+	fqn, ok := n.attributes[name]
+	if !ok {
+		fqn = &FQN{name: name.Local, space: name.Space, typeInfo: new(NodeTypeInfo)}
+		fqn.typeInfo.initialize()
+		fqn.typeInfo.addLayouts(ex.TimeLayouts)
+		fqn.typeInfo.addBoolVocabularies(ex.BoolVocabularies)
+		n.attributes[name] = fqn
+		ex.GlobalTagAttributesMap[key+"_"+name.Space+"_"+name.Local] = true
+		ex.GlobalTagAttributes[key] = append(ex.GlobalTagAttributes[key], fqn)
+	}
+	return fqn
+}
+
+// isNameSpaceDeclaration reports whether name is that of an xmlns or
+// xmlns:prefix attribute.
+func isNameSpaceDeclaration(name xml.Name) bool {
+	return name.Space == XMLNS || (name.Space == "" && name.Local == XMLNS)
+}
+
+// xsiSpace is the namespace of xsi:nil.
+const xsiSpace = "http://www.w3.org/2001/XMLSchema-instance"
+
+// isNil reports whether attrs hold xsi:nil="true". The prefix itself is
+// accepted when it was not declared.
+func isNil(attrs []xml.Attr) bool {
+	for _, attr := range attrs {
+		if attr.Name.Local == "nil" && (attr.Name.Space == xsiSpace || attr.Name.Space == "xsi") {
+			v := strings.TrimSpace(attr.Value)
+			return v == "true" || v == "1"
+		}
+	}
+	return false
+}
+
+// xmlSpace is the namespace of xml:space.
+const xmlSpace = "http://www.w3.org/XML/1998/namespace"
+
+// xmlSpacePreserve reports whether whitespace is significant in an
+// element with attrs, inside one where it is if inherited is set.
+func xmlSpacePreserve(attrs []xml.Attr, inherited bool) bool {
+	for _, attr := range attrs {
+		if attr.Name.Local == "space" && (attr.Name.Space == xmlSpace || attr.Name.Space == "xml") {
+			return attr.Value == "preserve"
+		}
+	}
+	return inherited
+}
+
+// isDocComment reports whether comment has a letter or digit: rules such
+// as <!-- ===== --> document nothing.
+func isDocComment(comment []byte) bool {
+	return bytes.IndexFunc(comment, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}) >= 0
+}
+
 func isJustSpacesAndLinefeeds(s string) bool {
 	s = strings.Replace(s, "\\n", "", -1)
 	s = strings.Replace(s, "\n", "", -1)
@@ -0,0 +1,32 @@
+package chidleystein
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+)
+
+func benchmarkExtract(b *testing.B, filename string) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ex := Extractor{Reader: bytes.NewReader(data)}
+		if err := ex.ExtractContext(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExtractActorPreludeSample(b *testing.B) {
+	benchmarkExtract(b, "xml/ActorPreludeSample.xml")
+}
+
+func BenchmarkExtractFantasiaConImitazione(b *testing.B) {
+	benchmarkExtract(b, "xml/Fantasia_con_imitazione_BWV563.xml")
+}
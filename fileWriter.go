@@ -7,34 +7,34 @@ import (
 )
 
 type fileWriter struct {
+	file        *os.File
+	bwriter     *bufio.Writer
+	doneChannel chan bool
 }
 
-var file *os.File
-var bwriter *bufio.Writer
-
 func (w *fileWriter) open(path string, lineChannel chan string) error {
 	var err error
-	file, err = os.Create(path)
+	w.file, err = os.Create(path)
 	if err != nil {
 		return err
 	}
 
-	doneChannel = make(chan bool)
-	bwriter = bufio.NewWriter(file)
-	go w.writer(lineChannel, doneChannel)
+	w.doneChannel = make(chan bool)
+	w.bwriter = bufio.NewWriter(w.file)
+	go w.writer(lineChannel, w.doneChannel)
 	return nil
 }
 
 func (w *fileWriter) close() {
-	_ = <-doneChannel
+	_ = <-w.doneChannel
 }
 
 func (w *fileWriter) writer(lineChannel chan string, doneChannel chan bool) {
 	for line := range lineChannel {
-		fmt.Fprintln(bwriter, line)
+		fmt.Fprintln(w.bwriter, line)
 	}
-	bwriter.Flush()
-	file.Close()
+	w.bwriter.Flush()
+	w.file.Close()
 	doneChannel <- true
 
 }
@@ -3,6 +3,13 @@ package chidleystein
 type FQN struct {
 	space string
 	name  string
+	// present is the number of element instances carrying the attribute.
+	present int
+	// firstAt is where the attribute was first seen: the start of the
+	// tag of the element carrying it.
+	firstAt Position
+	// typeInfo holds the types all its values parsed as.
+	typeInfo *NodeTypeInfo
 }
 
 type FQNAbbr struct {
@@ -0,0 +1,477 @@
+package chidleystein
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"sync"
+	"text/template"
+)
+
+// Options configures a single inference run and the code generated from
+// its Schema. Nothing is shared between runs, so any number of Infer
+// calls may run concurrently in one process.
+type Options struct {
+	NamePrefix          string
+	NameSuffix          string
+	AttributePrefix     string
+	UseType             bool
+	NameSpaceInJsonName bool
+	AddDbMetadata       bool
+	SortByXmlOrder      bool
+	Progress            bool
+	Debug               bool
+
+	// Keying decides which elements share a node, and so a type.
+	Keying NodeKeying
+
+	// ShareTypes makes elements of different names whose structs would
+	// be identical (same attributes, text type and children) share one
+	// struct, named according to SharedTypeNaming, or SharedTypeName
+	// when set. Text-only elements are never shared.
+	ShareTypes       bool
+	SharedTypeNaming SharedTypeNaming
+	SharedTypeName   func(elementNames []string) string
+
+	// TypePolicy picks the Go type of text and attribute fields from
+	// their values when UseType is set. FieldTypePolicies overrides it
+	// for single fields: an element name for its text, element@attribute
+	// for an attribute.
+	TypePolicy        TypePolicy
+	FieldTypePolicies map[string]TypePolicy
+
+	// TimeLayouts are time layouts, in the syntax of the time package,
+	// tried before the XML Schema date, time and duration forms when
+	// UseType is set. Fields whose values all parse as one get a type
+	// that reads and writes that layout.
+	TimeLayouts []string
+
+	// BoolVocabularies are spellings of true and false, such as Y/N,
+	// tried after those of strconv.ParseBool when UseType is set. Fields
+	// whose values all are one of a pair get a bool type that writes
+	// them back the same way.
+	BoolVocabularies []BoolVocabulary
+
+	// TupleFields names the fields of the tuples generated, when UseType
+	// is set, for lists of comma-separated parts such as KML coordinates,
+	// by field as for FieldTypePolicies: coordinates=Lon,Lat,Alt. Tuples
+	// of another size, and fields not listed, get V1, V2 and so on.
+	TupleFields map[string][]string
+
+	// Strictness selects which spellings of values count as evidence
+	// for a type.
+	Strictness Strictness
+
+	// EnumLimit, if positive, makes the fields taking at most that many
+	// distinct values, one of them at least twice, a named string type
+	// with a constant per value. With StrictnessStrict, unmarshaling the
+	// type refuses other values.
+	EnumLimit int
+
+	// UseOccurs shapes fields by how often the element was seen in each
+	// instance of its parent: a value when always exactly once, a slice
+	// when ever more than once, a pointer otherwise. Attributes missing
+	// from some instances are marked omitempty.
+	UseOccurs bool
+
+	// Provenance comments each generated struct, field and Java class
+	// with where its element, attribute or child was first seen: file,
+	// line, column and byte offset.
+	Provenance bool
+
+	// SampleComments comments each text and attribute field with a few
+	// of its values, picked at random, or only their shape.
+	SampleComments SampleComments
+
+	// MixedContent chooses the field holding the content of elements
+	// whose text is interleaved with child elements, in place of a text
+	// field and a field per child: nodes in document order, or raw XML.
+	// MixedElements overrides it for single elements, by name.
+	MixedContent  MixedContent
+	MixedElements map[string]MixedContent
+
+	// CatchAll gives every struct catch-all fields keeping the child
+	// elements and attributes not seen in the samples, which would
+	// otherwise be dropped; CatchAllElements gives them to the structs
+	// of the elements named only.
+	CatchAll         bool
+	CatchAllElements map[string]bool
+
+	// Workers bounds the number of inputs InferFiles extracts at the
+	// same time; zero means runtime.GOMAXPROCS(0).
+	Workers int
+}
+
+// SharedTypeNaming selects the name of a struct shared by elements of
+// different names.
+type SharedTypeNaming int
+
+const (
+	// SharedNameFirst names the struct after the first element found.
+	SharedNameFirst SharedTypeNaming = iota
+	// SharedNameCommon names it after the longest part the element names
+	// have in common, e.g. Date for DateCreated and PubDate, falling back
+	// to SharedNameFirst.
+	SharedNameCommon
+	// SharedNameNumbered names it Shared1, Shared2, ...
+	SharedNameNumbered
+)
+
+var sharedTypeNamingNames = []string{"first", "common", "numbered"}
+
+func (n SharedTypeNaming) String() string {
+	if n < 0 || int(n) >= len(sharedTypeNamingNames) {
+		return "SharedTypeNaming(" + strconv.Itoa(int(n)) + ")"
+	}
+	return sharedTypeNamingNames[n]
+}
+
+// ParseSharedTypeNaming returns the SharedTypeNaming named s: first,
+// common or numbered.
+func ParseSharedTypeNaming(s string) (SharedTypeNaming, error) {
+	for i, name := range sharedTypeNamingNames {
+		if s == name {
+			return SharedTypeNaming(i), nil
+		}
+	}
+	return SharedNameFirst, fmt.Errorf("chidley: unknown shared type naming %q (want first, common or numbered)", s)
+}
+
+// DefaultOptions returns the options used by the chidley command.
+func DefaultOptions() Options {
+	return Options{
+		NamePrefix:      "Chi",
+		AttributePrefix: "Attr_",
+	}
+}
+
+// Schema is the model inferred from XML input.
+type Schema struct {
+	Options Options
+	ex      *Extractor
+}
+
+// NewSchema returns an empty schema; inputs are folded into it with Add.
+func NewSchema(opts Options) *Schema {
+	ex := &Extractor{
+		NamePrefix:       opts.NamePrefix,
+		nameSuffix:       opts.NameSuffix,
+		Debug:            opts.Debug,
+		Progress:         opts.Progress,
+		Keying:           opts.Keying,
+		TimeLayouts:      opts.TimeLayouts,
+		BoolVocabularies: opts.BoolVocabularies,
+		Strictness:       opts.Strictness,
+		EnumLimit:        opts.EnumLimit,
+	}
+	ex.init()
+	return &Schema{Options: opts, ex: ex}
+}
+
+// Infer reads all of r and returns the inferred schema. It returns
+// ctx.Err() if ctx is cancelled before r is exhausted.
+func Infer(ctx context.Context, r io.Reader, opts Options) (*Schema, error) {
+	s := NewSchema(opts)
+	if err := s.Add(ctx, r); err != nil {
+		return nil, err
+	}
+	if s.ex.FirstNode == nil {
+		return nil, errNoElements
+	}
+	return s, nil
+}
+
+// InferFiles folds every file in filenames into one schema, so the union
+// of their elements, attributes and type evidence drives the generated
+// code. Files ending in gz or bz2 are decompressed transparently.
+//
+// Up to opts.Workers files are extracted concurrently, each into its own
+// Extractor. The models are merged in the order of filenames as soon as
+// all those before them are, so the result does not depend on scheduling
+// and only the models waiting for an earlier one are held.
+func InferFiles(ctx context.Context, filenames []string, opts Options) (*Schema, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(filenames) {
+		workers = len(filenames)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type extracted struct {
+		i   int
+		s   *Schema
+		err error
+	}
+	indexes := make(chan int)
+	results := make(chan extracted)
+	// A file is extracted at most 2*workers files ahead of the merge,
+	// which bounds the models waiting for a slow one.
+	window := make(chan struct{}, 2*workers)
+	go func() {
+		defer close(indexes)
+		for i := range filenames {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			indexes <- i
+		}
+	}()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				s := NewSchema(opts)
+				if err := s.addFile(ctx, filenames[i]); err != nil {
+					cancel()
+					results <- extracted{i: i, err: err}
+					continue
+				}
+				results <- extracted{i: i, s: s}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	s := NewSchema(opts)
+	errs := make([]error, len(filenames))
+	var mergeErr error
+	waiting := make(map[int]*Schema)
+	next := 0
+	for r := range results {
+		errs[r.i] = r.err
+		waiting[r.i] = r.s
+		for {
+			o, ok := waiting[next]
+			if !ok {
+				break
+			}
+			delete(waiting, next)
+			next++
+			<-window
+			if o == nil || ctx.Err() != nil {
+				continue
+			}
+			if err := s.Merge(o); err != nil {
+				mergeErr = err
+				cancel()
+			}
+		}
+	}
+
+	// Report the failure of the earliest input rather than the
+	// cancellations it caused in the others.
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+	}
+	if mergeErr != nil {
+		return nil, mergeErr
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Cancelled before every file was handed out.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s.ex.FirstNode == nil {
+		return nil, errNoElements
+	}
+	return s, nil
+}
+
+var errNoElements = errors.New("chidley: no XML elements found")
+
+// Add reads all of r and folds it into the schema.
+func (s *Schema) Add(ctx context.Context, r io.Reader) error {
+	s.ex.Reader = r
+	err := s.ex.ExtractContext(ctx)
+	s.ex.Reader = nil
+	return err
+}
+
+func (s *Schema) addFile(ctx context.Context, filename string) error {
+	source := new(FileSource)
+	if err := source.NewSource(filename); err != nil {
+		return err
+	}
+	defer source.Close()
+	s.ex.SourceName = filename
+	defer func() { s.ex.SourceName = "" }()
+	if err := s.Add(ctx, source.GetReader()); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+// Root returns the synthetic node holding the document element.
+func (s *Schema) Root() *Node {
+	return s.ex.Root
+}
+
+// FirstNode returns the document element.
+func (s *Schema) FirstNode() *Node {
+	return s.ex.FirstNode
+}
+
+// WriteGoStructs writes the Go structs for the schema to w.
+func (s *Schema) WriteGoStructs(w io.Writer) error {
+	structs, _ := s.goStructs(nil)
+	_, err := io.WriteString(w, structs)
+	return err
+}
+
+// WriteGoConverter writes a Go program to w that converts filename
+// (or any XML of the same shape) to JSON, XML or Go.
+func (s *Schema) WriteGoConverter(w io.Writer, filename string) error {
+	first := s.ex.FirstNode
+	namer := s.typeNamer()
+	xt := XMLType{NameType: namer.typeName(first),
+		XMLName:      first.Name,
+		XMLNameUpper: CapitalizeFirstLetter(first.Name),
+		XMLSpace:     first.Space,
+	}
+
+	nested := s.nestedTypes(namer)
+	structs, imports := s.goStructs(nested)
+	needs := []string{"regexp"}
+	if len(nested) > 0 {
+		needs = append(needs, "bytes", "encoding", "strconv")
+	}
+	for _, pkg := range needs {
+		if !containsString(imports, pkg) {
+			imports = append(imports, pkg)
+		}
+	}
+	x := XmlInfo{
+		BaseXML:         &xt,
+		OneLevelDownXML: makeOneLevelDown(s.ex.Root, namer),
+		Filename:        filename,
+		Structs:         structs,
+		Imports:         imports,
+		Mixed:           s.hasMixedContent(),
+		CatchAll:        s.hasCatchAll(),
+		NestedTypes:     nested,
+		ContentModels:   s.contentModels(),
+		Keying:          s.ex.Keying.String(),
+	}
+	t := template.Must(template.New("chidleyGen").Parse(CodeTemplate))
+	return t.Execute(w, x)
+}
+
+// goStructs returns the Go structs for the schema, and the packages they
+// need besides encoding/xml. nested names the structs the converter reads
+// with a stack of its own.
+func (s *Schema) goStructs(nested []string) (string, []string) {
+	lineChannel := make(chan string, 100)
+	sWriter := new(StringWriter)
+	sWriter.Open("", lineChannel)
+
+	v := s.goStructVisitor(lineChannel)
+	v.nested = make(map[string]bool, len(nested))
+	for _, name := range nested {
+		v.nested[name] = true
+	}
+
+	v.Visit(s.ex.Root)
+	v.namer = s.typeNamer()
+	v.recursion = findRecursion(s.ex.nodes(), v.typeName)
+
+	var structSort structSortFunc = printStructsAlphabetical
+	if s.Options.SortByXmlOrder {
+		structSort = printStructsByXml
+	}
+	structSort(v)
+
+	printTimeTypes(lineChannel, v.timeTypes)
+	printNullTypes(lineChannel, v.nullTypes)
+	printEnumTypes(lineChannel, v.enums)
+	printBoolTypes(lineChannel, v.boolTypes)
+	printListTypes(lineChannel, v.listItems, v.tuples, v.lists)
+	printMixedTypes(lineChannel, v.usesMixedNodes)
+	printCatchAllTypes(lineChannel, v.usesAnyElement)
+	imports := generatedTypeImports(v.timeTypes, v.nullTypes, v.listItems, v.usesTime)
+
+	close(lineChannel)
+	sWriter.Close()
+	return sWriter.S, imports
+}
+
+// goStructVisitor returns a visitor writing the Go structs for the schema
+// to lineChannel as the options ask.
+func (s *Schema) goStructVisitor(lineChannel chan string) *PrintGoStructVisitor {
+	v := new(PrintGoStructVisitor)
+	v.Init(lineChannel, 9999,
+		s.ex.GlobalTagAttributes,
+		s.ex.NameSpaceTagMap,
+		s.Options.UseType,
+		s.Options.NameSpaceInJsonName)
+	v.NamePrefix = s.Options.NamePrefix
+	v.NameSuffix = s.Options.NameSuffix
+	v.AttributePrefix = s.Options.AttributePrefix
+	v.AddDbMetadata = s.Options.AddDbMetadata
+	v.useOccurs = s.Options.UseOccurs
+	v.typePolicy = s.Options.TypePolicy
+	v.fieldTypePolicies = s.Options.FieldTypePolicies
+	v.timeLayouts = s.Options.TimeLayouts
+	v.enumLimit = s.Options.EnumLimit
+	v.strictEnums = s.Options.Strictness == StrictnessStrict
+	v.tupleFields = s.Options.TupleFields
+	v.provenance = s.Options.Provenance
+	v.samples = s.Options.SampleComments
+	v.mixedContent = s.Options.MixedContent
+	v.mixedElements = s.Options.MixedElements
+	v.catchAll = s.Options.CatchAll
+	v.catchAllElements = s.Options.CatchAllElements
+	return v
+}
+
+// typeNamer names the types of every node reachable from the root.
+func (s *Schema) typeNamer() *typeNamer {
+	nodes := []*Node{s.ex.Root}
+	for _, n := range s.ex.GlobalNodeMap {
+		nodes = append(nodes, n)
+	}
+	return newTypeNamer(nodes, s.ex.GlobalTagAttributes, s.Options, s.ex.Root, s.ex.FirstNode)
+}
+
+func makeOneLevelDown(node *Node, namer *typeNamer) []*XMLType {
+	var children []*XMLType
+
+	// Walk children in key order so the generated code is stable.
+	for _, npKey := range sortedChildKeys(node) {
+		np := node.Children[npKey]
+		if np == nil {
+			continue
+		}
+		for _, nKey := range sortedChildKeys(np) {
+			n := np.Children[nKey]
+			if n == nil {
+				continue
+			}
+			x := XMLType{NameType: namer.typeName(n),
+				XMLName:      n.Name,
+				XMLNameUpper: CapitalizeFirstLetter(n.Name),
+				XMLSpace:     n.Space}
+			children = append(children, &x)
+		}
+	}
+	return children
+}
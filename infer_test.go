@@ -0,0 +1,351 @@
+package chidleystein
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func inferString(t *testing.T, xml string, opts Options) *Schema {
+	t.Helper()
+	s, err := Infer(context.Background(), strings.NewReader(xml), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func goStructs(t *testing.T, s *Schema) string {
+	t.Helper()
+	var b bytes.Buffer
+	if err := s.WriteGoStructs(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestWriteGoStructs(t *testing.T) {
+	tests := []struct {
+		name    string
+		xml     string
+		options func(*Options)
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "untyped",
+			xml:  `<r><n k="1">12</n></r>`,
+			want: []string{
+				"\tAttr_k string `xml:\" k,attr\"  json:\",omitempty\"`",
+				"\tText string `xml:\",chardata\" json:\",omitempty\"`",
+				"\tChin *Chin `xml:\" n,omitempty\" json:\"n,omitempty\"`",
+			},
+		},
+		{
+			name:    "attribute types",
+			xml:     `<r><i count="12" on="true"/></r>`,
+			options: func(o *Options) { o.UseType = true },
+			want: []string{
+				"\tAttr_count int8 `xml:\" count,attr\"  json:\",omitempty\"`",
+				"\tAttr_on bool `xml:\" on,attr\"  json:\",omitempty\"`",
+			},
+		},
+		{
+			name:    "optional attributes",
+			xml:     `<r xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><n k="a" xsi:nil="true"/><n k="b">1</n></r>`,
+			options: func(o *Options) { o.UseType = true },
+			want: []string{
+				"\tAttr_k string `xml:\" k,attr\"  json:\",omitempty\"`",
+				"\tAttr_xsi_nil bool `xml:\"http://www.w3.org/2001/XMLSchema-instance nil,attr,omitempty\"  json:\",omitempty\"`",
+			},
+			notWant: []string{"xmlns"},
+		},
+		{
+			name:    "unsigned",
+			xml:     `<r><n>200</n></r>`,
+			options: func(o *Options) { o.UseType = true; o.TypePolicy = TypeSmallest },
+			want:    []string{"\tText uint8 "},
+		},
+		{
+			name:    "signed",
+			xml:     `<r><n>200</n></r>`,
+			options: func(o *Options) { o.UseType = true },
+			want:    []string{"\tText int16 "},
+		},
+		{
+			name:    "date",
+			xml:     `<r><d>2006-01-02</d></r>`,
+			options: func(o *Options) { o.UseType = true },
+			want:    []string{"\tText XsDate ", "type XsDate time.Time"},
+		},
+		{
+			name:    "lenient leading zeros",
+			xml:     `<r><z>007</z></r>`,
+			options: func(o *Options) { o.UseType = true },
+			want:    []string{"\tText int8 "},
+		},
+		{
+			name:    "strict leading zeros",
+			xml:     `<r><z>007</z></r>`,
+			options: func(o *Options) { o.UseType = true; o.Strictness = StrictnessStrict },
+			want:    []string{"\tText string "},
+		},
+		{
+			name:    "strict float",
+			xml:     `<r><f>1.50</f><g>1.5</g></r>`,
+			options: func(o *Options) { o.UseType = true; o.Strictness = StrictnessStrict },
+			want:    []string{"type Chif struct {\n\tText string ", "type Chig struct {\n\tText float32 "},
+		},
+		{
+			name:    "nullable",
+			xml:     `<r><n>12</n><n/></r>`,
+			options: func(o *Options) { o.UseType = true },
+			want:    []string{"\tText NullInt8 ", "type NullInt8 struct"},
+		},
+		{
+			name:    "enumeration",
+			xml:     `<r><s>open</s><s>open</s><s>closed</s></r>`,
+			options: func(o *Options) { o.UseType = true; o.EnumLimit = 2 },
+			want:    []string{"\tText ChisEnum ", "type ChisEnum string", `ChisEnum_open ChisEnum = "open"`},
+		},
+		{
+			name:    "enumeration named like an element",
+			xml:     `<r><Color>red</Color><Color>red</Color><ColorEnum><x>1</x></ColorEnum></r>`,
+			options: func(o *Options) { o.UseType = true; o.EnumLimit = 5 },
+			want:    []string{"type ChiColorEnum struct", "\tText ChiColorEnum_2 ", "type ChiColorEnum_2 string"},
+			notWant: []string{"type ChiColorEnum string"},
+		},
+		{
+			name:    "boolean vocabulary",
+			xml:     `<r><b>Y</b><b>N</b></r>`,
+			options: func(o *Options) { o.UseType = true; o.BoolVocabularies = DefaultBoolVocabularies },
+			want:    []string{"\tText BoolYN ", "type BoolYN bool"},
+		},
+		{
+			name:    "list",
+			xml:     `<r><v>1 2 3</v></r>`,
+			options: func(o *Options) { o.UseType = true },
+			want:    []string{"\tText Int8List ", "type Int8List []int8"},
+		},
+		{
+			name:    "tuple",
+			xml:     `<r><p>3,14</p><p>-5,20</p></r>`,
+			options: func(o *Options) { o.UseType = true },
+			want:    []string{"\tText ChipTupleList ", "type ChipTuple struct"},
+		},
+		{
+			name:    "no tuple of thousands",
+			xml:     `<r><p>3,14</p><p>1,000</p><q>1,000 2,500</q></r>`,
+			options: func(o *Options) { o.UseType = true },
+			want:    []string{"\tText string "},
+			notWant: []string{"Tuple", "List"},
+		},
+		{
+			name:    "keyed by parent",
+			xml:     `<r><a><name>x</name></a><b><name><f/></name></b></r>`,
+			options: func(o *Options) { o.Keying = KeyByParent },
+			want: []string{
+				"\tChiname *Chia_name `xml:\" name,omitempty\" json:\"name,omitempty\"`",
+				"\tChiname *Chib_name `xml:\" name,omitempty\" json:\"name,omitempty\"`",
+			},
+		},
+		{
+			name:    "shared types",
+			xml:     `<r><a><x/></a><b><x/></b></r>`,
+			options: func(o *Options) { o.ShareTypes = true },
+			want:    []string{"\tChib *Chia `xml:\" b,omitempty\" json:\"b,omitempty\"`"},
+			notWant: []string{"type Chib struct"},
+		},
+		{
+			name:    "occurrences",
+			xml:     `<r><a/><b/><b/></r><r><a/></r>`,
+			options: func(o *Options) { o.UseOccurs = true },
+			want: []string{
+				"\tChia Chia `xml:\" a,omitempty\" json:\"a,omitempty\"`",
+				"\tChib []*Chib `xml:\" b,omitempty\" json:\"b,omitempty\"`",
+			},
+		},
+		{
+			name:    "provenance",
+			xml:     "<r>\n <a/></r>",
+			options: func(o *Options) { o.Provenance = true },
+			want:    []string{"// r first seen at <input>:1:1, offset 0\n", "\t// r/a first seen at <input>:2:2, offset 5\n"},
+		},
+		{
+			name:    "samples",
+			xml:     `<r><a k="v">hello</a></r>`,
+			options: func(o *Options) { o.SampleComments = SamplesShown },
+			want:    []string{"\t// e.g. \"v\"\n\tAttr_k ", "\t// e.g. \"hello\"\n\tText "},
+		},
+		{
+			name: "comments",
+			xml:  `<!-- The root. --><r/>`,
+			want: []string{"// The root.\ntype Chir struct"},
+		},
+		{
+			name: "mixed content",
+			xml:  `<r><p>a <i>b</i> c</p></r>`,
+			want: []string{
+				"\tNodes []ChipNode `xml:\",any\" json:\"nodes,omitempty\"`",
+				"\tChii *Chii `xml:\"-\" json:\"i,omitempty\"`",
+			},
+		},
+		{
+			name:    "mixed content as inner XML",
+			xml:     `<r><p>a <i>b</i> c</p></r>`,
+			options: func(o *Options) { o.MixedContent = MixedInnerXML },
+			want:    []string{"\tInnerXML string `xml:\",innerxml\" json:\"innerxml,omitempty\"`"},
+		},
+		{
+			name:    "catch-all",
+			xml:     `<r a="1"><x/></r>`,
+			options: func(o *Options) { o.CatchAllElements = map[string]bool{"r": true} },
+			want: []string{
+				"\tAny []AnyElement `xml:\",any\" json:\"any,omitempty\"`",
+				"\tAnyAttrs []xml.Attr `xml:\",any,attr\" json:\"anyAttrs,omitempty\"`",
+			},
+		},
+		{
+			name: "document order",
+			xml:  `<r><b/><a/></r>`,
+			want: []string{"\tChib *Chib `xml:\" b,omitempty\" json:\"b,omitempty\"`\n\tChia *Chia "},
+		},
+		{
+			name:    "recursion",
+			xml:     `<r><s><s/></s></r>`,
+			options: func(o *Options) { o.UseOccurs = true },
+			want:    []string{"type Chis struct {\n\tChis *Chis `xml:\" s,omitempty\" json:\"s,omitempty\"`"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			if tt.options != nil {
+				tt.options(&opts)
+			}
+			got := goStructs(t, inferString(t, tt.xml, opts))
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("no %q in:\n%s", want, got)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("%q in:\n%s", notWant, got)
+				}
+			}
+		})
+	}
+}
+
+// endlessReader reads an unclosed document of ever more elements. It
+// calls cancel once past cancelAt bytes, and gives up with io.EOF past
+// 100 times as many.
+type endlessReader struct {
+	read     int
+	cancelAt int
+	cancel   func()
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	if r.read > 100*r.cancelAt {
+		return 0, io.EOF
+	}
+	if r.read > r.cancelAt {
+		r.cancel()
+	}
+	n := 0
+	if r.read == 0 {
+		n = copy(p, "<r>")
+	}
+	for n+len("<e>1</e>") <= len(p) {
+		n += copy(p[n:], "<e>1</e>")
+	}
+	r.read += n
+	return n, nil
+}
+
+func TestInferCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &endlessReader{cancelAt: 1 << 20, cancel: cancel}
+	if _, err := Infer(ctx, r, DefaultOptions()); err == nil || err != ctx.Err() {
+		t.Errorf("Infer cancelled: got %v, want %v", err, ctx.Err())
+	}
+	if r.read > 2*r.cancelAt {
+		t.Errorf("Infer read %d bytes, cancelled after %d", r.read, r.cancelAt)
+	}
+}
+
+// writeFiles writes each of docs to a file of its own and returns their
+// names, in order.
+func writeFiles(t *testing.T, docs []string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	var filenames []string
+	for i, doc := range docs {
+		filename := filepath.Join(dir, fmt.Sprintf("%03d.xml", i))
+		if err := os.WriteFile(filename, []byte(doc), 0644); err != nil {
+			t.Fatal(err)
+		}
+		filenames = append(filenames, filename)
+	}
+	return filenames
+}
+
+func TestInferFilesDeterministic(t *testing.T) {
+	var docs []string
+	for i := 0; i < 24; i++ {
+		docs = append(docs, fmt.Sprintf(`<r><e%d k="%d">%d</e%d><v>%s</v></r>`, i%5, i, i*300, i%5, strings.Repeat("x", i)))
+	}
+	filenames := writeFiles(t, docs)
+
+	opts := DefaultOptions()
+	opts.UseType = true
+	opts.Provenance = true
+	var want string
+	for _, workers := range []int{1, 2, 3, 8, 24} {
+		for run := 0; run < 3; run++ {
+			opts.Workers = workers
+			s, err := InferFiles(context.Background(), filenames, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b bytes.Buffer
+			if err := s.WriteModel(&b); err != nil {
+				t.Fatal(err)
+			}
+			got := goStructs(t, s) + b.String()
+			if want == "" {
+				want = got
+			} else if got != want {
+				t.Fatalf("%d workers, run %d: got\n%s\nwant\n%s", workers, run, got, want)
+			}
+		}
+	}
+}
+
+func TestInferFilesCancel(t *testing.T) {
+	doc := "<r>" + strings.Repeat(`<e k="1">2</e>`, 50000) + "</r>"
+	var docs []string
+	for i := 0; i < 8; i++ {
+		docs = append(docs, doc)
+	}
+	filenames := writeFiles(t, docs)
+
+	opts := DefaultOptions()
+	opts.Workers = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := InferFiles(ctx, filenames, opts); !errors.Is(err, context.Canceled) {
+		t.Errorf("InferFiles cancelled: got %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,79 @@
+package chidleystein
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// xmlFileSuffixes are the names picked up when a directory is given as
+// input. Files named explicitly are always used.
+var xmlFileSuffixes = []string{
+	".xml", ".xml.gz", ".xml.bz2",
+	".kml", ".kml.gz", ".kml.bz2",
+}
+
+// ExpandPaths turns file names, directories and glob patterns into a
+// sorted list of files without duplicates. Directories are walked
+// recursively for XML files.
+func ExpandPaths(args []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, arg := range args {
+		matches := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			var err error
+			matches, err = filepath.Glob(arg)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, &InternalError{ErrorString: "no files match " + arg}
+			}
+		}
+
+		for _, match := range matches {
+			fi, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !fi.IsDir() {
+				add(match)
+				continue
+			}
+			err = filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.Type().IsRegular() && hasXMLFileSuffix(path) {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func hasXMLFileSuffix(path string) bool {
+	path = strings.ToLower(path)
+	for _, suffix := range xmlFileSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
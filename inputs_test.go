@@ -0,0 +1,61 @@
+package chidleystein
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"d/b.xml", "d/a.KML.gz", "d/notes.txt", "d/sub/c.xml.bz2", "e.json", "z.xml"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("<r/>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	in := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+		return paths
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "files as given", args: in("z.xml", "e.json"), want: in("e.json", "z.xml")},
+		{name: "directory", args: in("d"), want: in("d/a.KML.gz", "d/b.xml", "d/sub/c.xml.bz2")},
+		{name: "glob", args: in("d/*.xml", "*.json"), want: in("d/b.xml", "e.json")},
+		{name: "duplicates", args: in("d", "d/b.xml", "d/*"), want: in("d/a.KML.gz", "d/b.xml", "d/notes.txt", "d/sub/c.xml.bz2")},
+		{name: "sorted", args: in("z.xml", "d/sub", "e.json"), want: in("d/sub/c.xml.bz2", "e.json", "z.xml")},
+		{name: "missing file", args: in("z.xml", "missing.xml"), wantErr: true},
+		{name: "glob matching nothing", args: in("*.missing"), wantErr: true},
+		{name: "bad glob", args: in("[z.xml"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandPaths(tt.args)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ExpandPaths(%q) = %q, want an error", tt.args, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExpandPaths(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
@@ -7,9 +7,14 @@ const JavaFloat = "float"
 const JavaDouble = "double"
 const JavaInt = "int"
 const JavaLong = "long"
+const JavaBigInteger = "java.math.BigInteger"
+
+const javaTimePackage = "java.time."
 
 const GoBool = "bool"
 
+const GoInt = "int"
+
 const GoInt8 = "int8"
 const GoUint8 = "uint8"
 const GoInt16 = "int16"
@@ -20,15 +25,51 @@ const GoInt32 = "int32"
 const GoUint32 = "uint32"
 const GoInt64 = "int64"
 
+const GoUint64 = "uint64"
+
 const GoFloat32 = "float32"
 
 const GoFloat64 = "float64"
 
-func findJavaType(nti *NodeTypeInfo, useType bool) string {
+const GoTime = "time.Time"
+
+// javaBoxes are the classes of the primitive types, for fields that may
+// be null.
+var javaBoxes = map[string]string{
+	JavaBoolean: "Boolean",
+	JavaShort:   "Short",
+	JavaInt:     "Integer",
+	JavaLong:    "Long",
+	JavaFloat:   "Float",
+	JavaDouble:  "Double",
+}
+
+// findJavaType maps the Go type chosen by policy to the narrowest Java
+// type holding all its values; Java has no unsigned types. Fields that
+// may be null get the class of a primitive type.
+func findJavaType(nti *NodeTypeInfo, useType bool, policy TypePolicy, layouts []string) string {
+	javaType := findJavaPrimitiveType(nti, useType, policy, layouts)
+	if box, ok := javaBoxes[javaType]; ok && nti.isNullable() {
+		return box
+	}
+	return javaType
+}
+
+func findJavaPrimitiveType(nti *NodeTypeInfo, useType bool, policy TypePolicy, layouts []string) string {
 	if !useType {
 		return JavaString
 	}
-	goType := findType(nti, true)
+	goType := findType(nti, true, policy, layouts)
+	if k := nti.timeKind(layouts); k != nil && k.name == goType {
+		if k.javaType == "" {
+			return JavaString
+		}
+		return javaTimePackage + k.javaType
+	}
+
+	if b := nti.boolVocabulary(); b != nil && b.typeName() == goType {
+		return JavaBoolean
+	}
 
 	switch goType {
 	case GoBool:
@@ -39,6 +80,8 @@ func findJavaType(nti *NodeTypeInfo, useType bool) string {
 		return JavaInt
 	case GoUint32, GoInt64:
 		return JavaLong
+	case GoUint64:
+		return JavaBigInteger
 	case GoFloat32:
 		return JavaFloat
 	case GoFloat64:
@@ -25,7 +25,26 @@ type JaxbClassInfo struct {
 	Fields                 []*JaxbField
 	HasValue               bool
 	ValueType              string
-	Date                   time.Time
+	ValueAdapter           string
+	ValueList              bool
+	// Mixed replaces the fields and value of an element with mixed
+	// content by a list of its text and child elements.
+	Mixed bool
+	// CatchAll adds fields keeping the child elements and attributes no
+	// other field takes.
+	CatchAll bool
+	// ContentModel is the order and grouping of the child elements, like
+	// a DTD content model.
+	ContentModel string
+	// Doc holds the lines of the XML comments before the element.
+	Doc []string
+	// Provenance and ValueProvenance say where the element and its text
+	// were first seen, and ValueSamples lists some of its values, if
+	// asked for.
+	Provenance      string
+	ValueProvenance string
+	ValueSamples    string
+	Date            time.Time
 }
 
 type JaxbAttribute struct {
@@ -33,7 +52,44 @@ type JaxbAttribute struct {
 	NameUpper string
 	NameLower string
 	NameSpace string
+	Type      string
+	Adapter   string
+	List      bool
+	// Samples lists some of its values and Provenance says where the
+	// attribute was first seen, if asked for.
+	Samples    string
+	Provenance string
+}
+
+// JaxbAdapterInfo describes the XmlAdapter between a java.time class and
+// its ISO 8601 text.
+type JaxbAdapterInfo struct {
+	PackageName, ClassName string
+	Type                   string
+	Date                   time.Time
+}
+
+// JaxbBoolAdapterInfo describes the XmlAdapter between a Boolean and its
+// spellings True and False.
+type JaxbBoolAdapterInfo struct {
+	PackageName, ClassName string
+	True, False            string
+	Date                   time.Time
+}
+
+// JaxbEnumInfo describes the enum generated for a field taking a few
+// values.
+type JaxbEnumInfo struct {
+	PackageName, ClassName string
+	Values                 []*JaxbEnumValue
+	Date                   time.Time
+}
+
+type JaxbEnumValue struct {
+	Name  string
+	Value string
 }
+
 type JaxbField struct {
 	TypeName  string
 	Name      string
@@ -41,6 +97,10 @@ type JaxbField struct {
 	NameLower string
 	NameSpace string
 	Repeats   bool
+	// Recursive is set if the child leads back to the class.
+	Recursive bool
+	// Provenance says where the child was first seen, if asked for.
+	Provenance string
 }
 
 func (jb *JaxbClassInfo) init() {
@@ -56,31 +116,121 @@ package {{.PackageName}}.xml;
 
 import java.util.ArrayList;
 import javax.xml.bind.annotation.*;
+import javax.xml.bind.annotation.adapters.XmlJavaTypeAdapter;
 import com.google.gson.annotations.SerializedName;
-
+{{if .Doc}}
+/**{{range .Doc}}
+ *{{if .}} {{.}}{{end}}{{end}}
+ */{{end}}{{if .Provenance}}
+// {{.Provenance}}{{end}}
 @XmlAccessorType(XmlAccessType.FIELD)
 @XmlRootElement(name="{{.Name}}")
 public class {{.ClassName}} {
 {{if .Attributes}}
     // Attributes{{end}}
-{{range .Attributes}}
+{{range .Attributes}}{{if .Samples}}
+    // {{.Samples}}{{end}}{{if .Provenance}}
+    // {{.Provenance}}{{end}}
 {{if .NameSpace}}
-@XmlAttribute(namespace = "{{.NameSpace}}"){{else}}    @XmlAttribute(name="{{.Name}}"){{end}}
-    @SerializedName("{{.Name}}")
-    public String {{.NameLower}};{{end}}
-{{if .Fields}}
-    // Fields{{end}}{{range .Fields}}
+    @XmlAttribute(name="{{.Name}}", namespace = "{{.NameSpace}}"){{else}}    @XmlAttribute(name="{{.Name}}"){{end}}
+    @SerializedName("{{.Name}}"){{if .List}}
+    @XmlList{{end}}{{if .Adapter}}
+    @XmlJavaTypeAdapter({{.Adapter}}.class){{end}}
+    public {{.Type}} {{.NameLower}};{{end}}
+{{if .Mixed}}
+    // Content: text and child elements, in order
+    @XmlMixed
+    @XmlAnyElement(lax = true)
+    public java.util.List<Object> content;
+{{end}}{{if .Fields}}
+    // Fields{{if .ContentModel}}, in the order of the content model {{.ContentModel}}{{end}}{{end}}{{range .Fields}}{{if .Provenance}}
+    // {{.Provenance}}{{end}}{{if .Recursive}}
+    // Recursive: leads back to {{$.ClassName}}{{end}}
     @XmlElement(name="{{.Name}}")
     @SerializedName("{{.Name}}")
     {{if .Repeats}}public ArrayList<{{.TypeName}}> {{.NameLower}}{{else}}public {{.TypeName}} {{.NameLower}}{{end}};
+{{end}}{{if .CatchAll}}
+    // Catch-all: child elements and attributes not seen in the samples{{if not .Mixed}}
+    @XmlAnyElement(lax = true)
+    public java.util.List<Object> any;{{end}}
+    @XmlAnyAttribute
+    public java.util.Map<javax.xml.namespace.QName, String> otherAttributes;
 {{end}}
 {{if .HasValue}}
-    // Value
-    @XmlValue
+    // Value{{if .ValueSamples}}
+    // {{.ValueSamples}}{{end}}{{if .ValueProvenance}}
+    // {{.ValueProvenance}}{{end}}
+    @XmlValue{{if .ValueList}}
+    @XmlList{{end}}{{if .ValueAdapter}}
+    @XmlJavaTypeAdapter({{.ValueAdapter}}.class){{end}}
     public {{.ValueType}} tagValue;{{end}}
 }
 `
 
+const jaxbAdapterTemplate = `
+// Generated by chidley https://github.com/gnewton/chidley
+// Date: {{.Date}}
+//
+package {{.PackageName}}.xml;
+
+import java.time.{{.Type}};
+import javax.xml.bind.annotation.adapters.XmlAdapter;
+
+public class {{.ClassName}} extends XmlAdapter<String, {{.Type}}> {
+    @Override
+    public {{.Type}} unmarshal(String v) {
+        return {{.Type}}.parse(v.trim());
+    }
+
+    @Override
+    public String marshal({{.Type}} v) {
+        return v.toString();
+    }
+}
+`
+
+const jaxbBoolAdapterTemplate = `
+// Generated by chidley https://github.com/gnewton/chidley
+// Date: {{.Date}}
+//
+package {{.PackageName}}.xml;
+
+import javax.xml.bind.annotation.adapters.XmlAdapter;
+
+public class {{.ClassName}} extends XmlAdapter<String, Boolean> {
+    @Override
+    public Boolean unmarshal(String v) {
+        switch (v.trim()) {
+        case {{printf "%q" .True}}:
+            return Boolean.TRUE;
+        case {{printf "%q" .False}}:
+            return Boolean.FALSE;
+        }
+        throw new IllegalArgumentException("invalid boolean: " + v);
+    }
+
+    @Override
+    public String marshal(Boolean v) {
+        return v ? {{printf "%q" .True}} : {{printf "%q" .False}};
+    }
+}
+`
+
+const jaxbEnumTemplate = `
+// Generated by chidley https://github.com/gnewton/chidley
+// Date: {{.Date}}
+//
+package {{.PackageName}}.xml;
+
+import javax.xml.bind.annotation.*;
+
+@XmlEnum
+public enum {{.ClassName}} {
+{{range $i, $v := .Values}}{{if $i}},
+{{end}}    @XmlEnumValue({{printf "%q" $v.Value}}) {{$v.Name}}{{end}}
+}
+`
+
 const jaxbMainTemplate = `
 // Generated by chidley https://github.com/gnewton/chidley
 // Date: {{.Date}}
@@ -0,0 +1,73 @@
+package chidleystein
+
+import (
+	"fmt"
+)
+
+// NodeKeying selects which elements are folded into the same Node, and so
+// into the same generated type.
+type NodeKeying int
+
+const (
+	// KeyByName folds every element with the same namespace and name.
+	KeyByName NodeKeying = iota
+	// KeyByParent keeps elements apart when their parents have different
+	// names, so <author><name> and <company><name> are two nodes.
+	KeyByParent
+	// KeyByPath keeps elements apart when their paths from the document
+	// element differ.
+	KeyByPath
+)
+
+var nodeKeyingNames = []string{"name", "parent", "path"}
+
+func (k NodeKeying) String() string {
+	if k < 0 || int(k) >= len(nodeKeyingNames) {
+		return fmt.Sprintf("NodeKeying(%d)", int(k))
+	}
+	return nodeKeyingNames[k]
+}
+
+// ParseNodeKeying returns the NodeKeying named s: name, parent or path.
+func ParseNodeKeying(s string) (NodeKeying, error) {
+	for i, name := range nodeKeyingNames {
+		if s == name {
+			return NodeKeying(i), nil
+		}
+	}
+	return KeyByName, fmt.Errorf("chidley: unknown node keying %q (want name, parent or path)", s)
+}
+
+// childKey returns the GlobalNodeMap key of the child with local key
+// localKey (see nks) under parent. Children of the document root are
+// keyed by name whatever the keying.
+func (ex *Extractor) childKey(parent *Node, localKey string) string {
+	if parent == ex.Root {
+		return localKey
+	}
+	switch ex.Keying {
+	case KeyByParent:
+		return nks(parent.Space, parent.Name) + "/" + localKey
+	case KeyByPath:
+		return parent.key + "/" + localKey
+	}
+	return localKey
+}
+
+// childContext returns the names of the ancestors that distinguish a
+// child of parent from other elements with the same name, outermost
+// first.
+func (ex *Extractor) childContext(parent *Node) []string {
+	if parent == ex.Root {
+		return nil
+	}
+	switch ex.Keying {
+	case KeyByParent:
+		return []string{parent.Name}
+	case KeyByPath:
+		context := make([]string, 0, len(parent.context)+1)
+		context = append(context, parent.context...)
+		return append(context, parent.Name)
+	}
+	return nil
+}
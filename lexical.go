@@ -0,0 +1,90 @@
+package chidleystein
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Strictness selects which spellings of values count as evidence for a
+// type.
+type Strictness int
+
+const (
+	// StrictnessLenient accepts anything the strconv package parses,
+	// such as "t" for true or "Inf" for a float.
+	StrictnessLenient Strictness = iota
+	// StrictnessXSD accepts the lexical spaces of the XML Schema types:
+	// true, false, 1 and 0 for booleans, no hex or Inf floats.
+	StrictnessXSD
+	// StrictnessStrict also refuses values that would not be written
+	// back the same way: leading zeros as in zip code "007", a leading
+	// "+", NaN and INF, booleans other than true and false, and floats
+	// such as "1.50", "1.0" or "1e5" that Go writes as 1.5, 1 or 100000.
+	StrictnessStrict
+)
+
+var strictnessNames = []string{"lenient", "xsd", "strict"}
+
+func (s Strictness) String() string {
+	if s < 0 || int(s) >= len(strictnessNames) {
+		return "Strictness(" + strconv.Itoa(int(s)) + ")"
+	}
+	return strictnessNames[s]
+}
+
+// ParseStrictness returns the Strictness named s: lenient, xsd or strict.
+func ParseStrictness(s string) (Strictness, error) {
+	for i, name := range strictnessNames {
+		if s == name {
+			return Strictness(i), nil
+		}
+	}
+	return StrictnessLenient, fmt.Errorf("chidley: unknown strictness %q (want lenient, xsd or strict)", s)
+}
+
+var (
+	xsdInteger    = regexp.MustCompile(`^[+-]?[0-9]+$`)
+	strictInteger = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+	xsdFloat      = regexp.MustCompile(`^([+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([Ee][+-]?[0-9]+)?|[+-]?INF|NaN)$`)
+	strictFloat   = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([Ee][+-]?[0-9]+)?$`)
+)
+
+// lexicalBool reports whether v spells a boolean at strictness s.
+func lexicalBool(v string, s Strictness) bool {
+	switch s {
+	case StrictnessXSD:
+		return v == "true" || v == "false" || v == "1" || v == "0"
+	case StrictnessStrict:
+		return v == "true" || v == "false"
+	}
+	return true
+}
+
+// lexicalInteger reports whether v spells an integer at strictness s.
+func lexicalInteger(v string, s Strictness) bool {
+	switch s {
+	case StrictnessXSD:
+		return xsdInteger.MatchString(v)
+	case StrictnessStrict:
+		return strictInteger.MatchString(v) && v != "-0"
+	}
+	return true
+}
+
+// lexicalFloat reports whether v spells a float of bitSize bits at
+// strictness s.
+func lexicalFloat(v string, s Strictness, bitSize int) bool {
+	switch s {
+	case StrictnessXSD:
+		return xsdFloat.MatchString(v)
+	case StrictnessStrict:
+		if !strictFloat.MatchString(v) {
+			return false
+		}
+		// Written back as encoding/xml writes a float.
+		f, err := strconv.ParseFloat(v, bitSize)
+		return err == nil && strconv.FormatFloat(f, 'g', -1, bitSize) == v
+	}
+	return true
+}
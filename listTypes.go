@@ -0,0 +1,443 @@
+package chidleystein
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// listSeparators are the characters that make a value a list candidate.
+const listSeparators = " \t\r\n,"
+
+// listInfo follows the values of a field as lists, like xs:list: tokens
+// separated by whitespace, each made of parts separated by commas, as in
+// the "lon,lat,alt lon,lat,alt" of KML coordinates.
+type listInfo struct {
+	// items are the types of the tokens, parts those of their parts.
+	items, parts *NodeTypeInfo
+	// tupleSize is the number of parts of every token, 0 before any
+	// token and -1 if it varies.
+	tupleSize int
+	// spaced is set once a value had more than one token.
+	spaced bool
+}
+
+// checkList records the tokens and parts of v. The list is only tracked
+// from the first value with a separator: the values before were single
+// tokens of one part, whose types nti already holds.
+func (nti *NodeTypeInfo) checkList(v string, s Strictness, enumLimit int, at *Position) {
+	if nti.notList {
+		return
+	}
+	v = strings.TrimSpace(v)
+	if nti.list == nil {
+		if !strings.ContainsAny(v, listSeparators) {
+			return
+		}
+		nti.list = newListInfo(nti)
+	}
+	l := nti.list
+	tokens := strings.Fields(v)
+	if len(tokens) > 1 {
+		l.spaced = true
+	}
+	for _, token := range tokens {
+		l.items.checkFieldType(token, s, at)
+		if enumLimit > 0 {
+			l.items.countValue(token, enumLimit)
+		}
+		parts := strings.Split(token, ",")
+		l.tupleSize = mergeTupleSize(l.tupleSize, len(parts))
+		for _, part := range parts {
+			// An integer part must be written back as read: "1,000" is
+			// a thousand, not the tuple 1,0.
+			ps := s
+			if len(parts) > 1 && xsdInteger.MatchString(part) {
+				ps = StrictnessStrict
+			}
+			l.parts.checkFieldType(part, ps, at)
+		}
+	}
+	if l.items.onlyString() && l.parts.onlyString() && (enumLimit <= 0 || l.items.tooManyValues) {
+		nti.list = nil
+		nti.notList = true
+	}
+}
+
+// newListInfo starts a list whose tokens so far were the values seen by
+// nti.
+func newListInfo(nti *NodeTypeInfo) *listInfo {
+	l := &listInfo{items: nti.scalarClone(), parts: nti.scalarClone()}
+	if nti.example != "" {
+		l.tupleSize = 1
+	}
+	return l
+}
+
+// scalarClone returns a copy of nti without its list.
+func (nti *NodeTypeInfo) scalarClone() *NodeTypeInfo {
+	c := nti.clone()
+	c.list = nil
+	c.notList = true
+	return c
+}
+
+func (l *listInfo) clone() *listInfo {
+	if l == nil {
+		return nil
+	}
+	return &listInfo{items: l.items.clone(), parts: l.parts.clone(), tupleSize: l.tupleSize, spaced: l.spaced}
+}
+
+func mergeTupleSize(a, b int) int {
+	switch {
+	case a == 0:
+		return b
+	case b == 0 || a == b:
+		return a
+	}
+	return -1
+}
+
+// mergeList merges the list of o into that of n, before their other
+// types are merged: a side without a list only had single tokens.
+func (n *NodeTypeInfo) mergeList(o *NodeTypeInfo) {
+	switch {
+	case n.notList && n.list == nil:
+	case o.notList && o.list == nil:
+		n.list = nil
+		n.notList = true
+	case n.list == nil && o.list == nil:
+	default:
+		if n.list == nil {
+			n.list = newListInfo(n)
+		}
+		ol := o.list
+		if ol == nil {
+			ol = newListInfo(o)
+		}
+		n.list.items.merge(ol.items)
+		n.list.parts.merge(ol.parts)
+		n.list.tupleSize = mergeTupleSize(n.list.tupleSize, ol.tupleSize)
+		n.list.spaced = n.list.spaced || ol.spaced
+	}
+}
+
+// onlyString reports whether the values seen by nti fit no type but
+// string.
+func (nti *NodeTypeInfo) onlyString() bool {
+	if nti.alwaysBool || nti.alwaysFloat64 || nti.alwaysInt0 || nti.alwaysInt64 || nti.alwaysUint64 {
+		return false
+	}
+	if nti.alwaysDateTime || nti.alwaysLocalDateTime || nti.alwaysDate || nti.alwaysDateZone ||
+		nti.alwaysTime || nti.alwaysTimeZone || nti.alwaysDuration {
+		return false
+	}
+	for _, l := range nti.layouts {
+		if l.always {
+			return false
+		}
+	}
+	return nti.boolVocabulary() == nil
+}
+
+// listShape is a list of typed items found in the values of a field.
+type listShape struct {
+	// item holds the types of the items: the tokens, or the parts of
+	// tuples and comma-separated lists.
+	item *NodeTypeInfo
+	// itemType is the Go type of the items, or string for enumeration
+	// values.
+	itemType string
+	// enumValues are the values of enumeration items.
+	enumValues []string
+	// separator is " " or ",".
+	separator string
+	// tupleSize is the number of parts of tuples, or 0.
+	tupleSize int
+}
+
+// listShape returns the list the values of nti make, or nil: tokens all
+// of one type, some value having several; tokens that all are tuples of
+// the same number of parts of one type; or single tokens of a varying
+// number of parts of one type. Only whitespace-separated tokens may be
+// enumeration values.
+func (nti *NodeTypeInfo) listShape(policy TypePolicy, layouts []string, enumLimit int) *listShape {
+	l := nti.list
+	if l == nil || nti.padded {
+		return nil
+	}
+	var shape *listShape
+	switch {
+	case l.tupleSize >= 2:
+		shape = &listShape{item: l.parts, separator: " ", tupleSize: l.tupleSize}
+	case l.tupleSize == -1 && !l.spaced:
+		shape = &listShape{item: l.parts, separator: ","}
+	case l.tupleSize == 1 && l.spaced:
+		shape = &listShape{item: l.items, separator: " "}
+	default:
+		return nil
+	}
+	shape.itemType = findType(shape.item, true, policy, layouts)
+	if shape.itemType == "string" {
+		if shape.item != l.items {
+			return nil
+		}
+		shape.enumValues = shape.item.enumValues(enumLimit)
+		if shape.enumValues == nil || !shape.item.valuesRepeat() {
+			return nil
+		}
+	}
+	return shape
+}
+
+// valuesRepeat reports whether the values counted were seen twice on
+// average. Prose reuses a few words, such as "for" in "Finale 2011 for
+// Windows" and "Dolet 6.0 for Finale", but not that much.
+func (nti *NodeTypeInfo) valuesRepeat() bool {
+	total := 0
+	for _, count := range nti.values {
+		total += count
+	}
+	return total >= 2*len(nti.values)
+}
+
+// signature summarizes the shape for typeNamer.
+func (shape *listShape) signature(fields []string) string {
+	s := "list " + strconv.Quote(shape.separator) + " " + shape.itemType
+	if shape.enumValues != nil {
+		s += " enum " + strconv.Quote(strings.Join(shape.enumValues, "\n"))
+	}
+	if shape.tupleSize > 0 {
+		s += " tuple " + strings.Join(fields, ",")
+	}
+	return s
+}
+
+// tupleFieldNames returns the names of the fields of a tuple of size
+// parts, those given for field in tupleFields if there are as many, else
+// V1, V2 and so on.
+func tupleFieldNames(tupleFields map[string][]string, field string, size int) []string {
+	if names := tupleFields[field]; len(names) == size {
+		return names
+	}
+	names := make([]string, size)
+	for i := range names {
+		names[i] = "V" + strconv.Itoa(i+1)
+	}
+	return names
+}
+
+// listItemName names the helpers of a list item type, as in
+// parseFloat64, and prefixes the list type, as in Float64List.
+func listItemName(goType string) string {
+	return capitalizeFirstLetter(strings.TrimPrefix(goType, "time."))
+}
+
+// listTypeName names the list of goType items separated by separator.
+func listTypeName(goType string, separator string) string {
+	if separator == "," {
+		return listItemName(goType) + "CommaList"
+	}
+	return listItemName(goType) + "List"
+}
+
+// listTypeNames returns the names of the list types that may be
+// generated for items of a Go or generated type, so that no struct takes
+// them.
+func listTypeNames(layouts []string, vocabularies []BoolVocabulary) []string {
+	itemTypes := append([]string{GoBool, GoTime, GoInt, GoInt8, GoInt16, GoInt32, GoInt64, GoUint8, GoUint16, GoUint32, GoUint64, GoFloat32, GoFloat64},
+		timeTypeNames(layouts)...)
+	for _, b := range vocabularies {
+		itemTypes = append(itemTypes, b.typeName())
+	}
+	var names []string
+	for _, t := range itemTypes {
+		names = append(names, listTypeName(t, " "), listTypeName(t, ","))
+	}
+	return names
+}
+
+// listType is a generated slice type read and written as text.
+type listType struct {
+	name      string
+	item      string
+	separator string
+}
+
+// tupleType is a generated struct of parts of one type, read and written
+// as text separated by commas.
+type tupleType struct {
+	name   string
+	part   string
+	fields []string
+}
+
+// listItem is a type of list items or tuple parts, with the parse and
+// format helpers the generated list and tuple types call.
+type listItem struct {
+	goType string
+	// enum is set for enumeration values.
+	enum *enumType
+}
+
+// printListTypes writes the types and helpers generated for lists.
+func printListTypes(lineChannel chan string, items map[string]*listItem, tuples map[string]*tupleType, lists map[string]*listType) {
+	var names []string
+	for name := range tuples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lineChannel <- tupleSource(tuples[name])
+	}
+
+	names = names[:0]
+	for name := range lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lineChannel <- listTypeSource(lists[name])
+	}
+
+	names = names[:0]
+	for name := range items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lineChannel <- listItemSource(items[name])
+	}
+}
+
+func listTypeSource(l *listType) string {
+	split := "strings.Fields(string(b))"
+	if l.separator == "," {
+		split = "strings.FieldsFunc(string(b), func(r rune) bool { return r == ',' })"
+	}
+	return strings.NewReplacer("NAME", l.name, "ITEMNAME", listItemName(l.item), "ITEM", l.item,
+		"SEPARATOR", strconv.Quote(l.separator), "SPLIT", split).Replace(listSource)
+}
+
+const listSource = `// NAME is a list of ITEM read and written as text separated by SEPARATOR.
+type NAME []ITEM
+
+func (l NAME) MarshalText() ([]byte, error) {
+	items := make([]string, len(l))
+	for i, v := range l {
+		s, err := formatITEMNAME(v)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = s
+	}
+	return []byte(strings.Join(items, SEPARATOR)), nil
+}
+
+func (l *NAME) UnmarshalText(b []byte) error {
+	*l = nil
+	for _, s := range SPLIT {
+		v, err := parseITEMNAME(s)
+		if err != nil {
+			return err
+		}
+		*l = append(*l, v)
+	}
+	return nil
+}
+
+func (l NAME) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]ITEM(l))
+}
+`
+
+func tupleSource(t *tupleType) string {
+	var b strings.Builder
+	b.WriteString("// " + t.name + " is a tuple of " + t.part + " read and written as text separated by \",\".\n")
+	b.WriteString("type " + t.name + " struct {\n")
+	for _, field := range t.fields {
+		b.WriteString("\t" + field + " " + t.part + "\n")
+	}
+	b.WriteString("}\n\n")
+
+	size := strconv.Itoa(len(t.fields))
+	partName := listItemName(t.part)
+	b.WriteString("func (t " + t.name + ") MarshalText() ([]byte, error) {\n")
+	b.WriteString("\tparts := make([]string, " + size + ")\n\tvar err error\n")
+	for i, field := range t.fields {
+		b.WriteString("\tif parts[" + strconv.Itoa(i) + "], err = format" + partName + "(t." + field + "); err != nil {\n\t\treturn nil, err\n\t}\n")
+	}
+	b.WriteString("\treturn []byte(strings.Join(parts, \",\")), nil\n}\n\n")
+
+	b.WriteString("func (t *" + t.name + ") UnmarshalText(b []byte) error {\n")
+	b.WriteString("\tparts := strings.Split(string(b), \",\")\n")
+	b.WriteString("\tif len(parts) != " + size + " {\n\t\treturn fmt.Errorf(\"invalid " + t.name + " %q\", b)\n\t}\n\tvar err error\n")
+	for i, field := range t.fields {
+		b.WriteString("\tif t." + field + ", err = parse" + partName + "(parts[" + strconv.Itoa(i) + "]); err != nil {\n\t\treturn err\n\t}\n")
+	}
+	b.WriteString("\treturn nil\n}\n\n")
+
+	b.WriteString("func (t " + t.name + ") MarshalJSON() ([]byte, error) {\n")
+	b.WriteString("\ttype plain " + t.name + "\n\treturn json.Marshal(plain(t))\n}\n")
+	return b.String()
+}
+
+func listItemSource(item *listItem) string {
+	r := strings.NewReplacer("NAME", listItemName(item.goType), "GOTYPE", item.goType)
+	if item.enum != nil {
+		if item.enum.strict {
+			return r.Replace(strictEnumItemSource)
+		}
+		return r.Replace(enumItemSource)
+	}
+	if k, ok := nullKinds[item.goType]; ok && k.parse != "" {
+		return strings.NewReplacer("PARSE", k.parse, "FORMAT", k.format).Replace(r.Replace(parseItemSource))
+	}
+	return r.Replace(textItemSource)
+}
+
+const parseItemSource = `func parseNAME(s string) (GOTYPE, error) {
+	s = strings.TrimSpace(s)
+	v, err := PARSE
+	return GOTYPE(v), err
+}
+
+func formatNAME(v GOTYPE) (string, error) {
+	return FORMAT, nil
+}
+`
+
+const textItemSource = `func parseNAME(s string) (GOTYPE, error) {
+	var v GOTYPE
+	err := v.UnmarshalText([]byte(strings.TrimSpace(s)))
+	return v, err
+}
+
+func formatNAME(v GOTYPE) (string, error) {
+	b, err := v.MarshalText()
+	return string(b), err
+}
+`
+
+const enumItemSource = `func parseNAME(s string) (GOTYPE, error) {
+	return GOTYPE(strings.TrimSpace(s)), nil
+}
+
+func formatNAME(v GOTYPE) (string, error) {
+	return string(v), nil
+}
+`
+
+const strictEnumItemSource = `func parseNAME(s string) (GOTYPE, error) {
+	v := GOTYPE(strings.TrimSpace(s))
+	if !v.Valid() {
+		return v, fmt.Errorf("invalid GOTYPE %q", s)
+	}
+	return v, nil
+}
+
+func formatNAME(v GOTYPE) (string, error) {
+	return string(v), nil
+}
+`
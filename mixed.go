@@ -0,0 +1,216 @@
+package chidleystein
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MixedContent selects the field generated for an element whose text is
+// interleaved with child elements, such as <p>a <i>b</i> c</p>.
+type MixedContent int
+
+const (
+	// MixedNodes holds the content in a slice of nodes, each a run of
+	// text or one child element, in document order.
+	MixedNodes MixedContent = iota
+	// MixedInnerXML holds the content as raw XML in an ,innerxml field.
+	MixedInnerXML
+)
+
+var mixedContentNames = []string{"nodes", "innerxml"}
+
+func (m MixedContent) String() string {
+	if m < 0 || int(m) >= len(mixedContentNames) {
+		return "MixedContent(" + strconv.Itoa(int(m)) + ")"
+	}
+	return mixedContentNames[m]
+}
+
+// ParseMixedContent returns the MixedContent named s: nodes or innerxml.
+func ParseMixedContent(s string) (MixedContent, error) {
+	for i, name := range mixedContentNames {
+		if s == name {
+			return MixedContent(i), nil
+		}
+	}
+	return MixedNodes, fmt.Errorf("chidley: unknown mixed content %q (want nodes or innerxml)", s)
+}
+
+// mixedFor returns how the content of n is held if it is mixed: as in
+// elements for its name, or def.
+func mixedFor(def MixedContent, elements map[string]MixedContent, n *Node) MixedContent {
+	if m, ok := elements[n.Name]; ok {
+		return m
+	}
+	return def
+}
+
+func (o Options) mixedFor(n *Node) MixedContent {
+	return mixedFor(o.MixedContent, o.MixedElements, n)
+}
+
+// hasMixedContent reports whether some element has mixed content.
+func (s *Schema) hasMixedContent() bool {
+	for _, n := range s.ex.GlobalNodeMap {
+		if n.mixed {
+			return true
+		}
+	}
+	return false
+}
+
+// printMixedField writes the field holding the mixed content of n.
+func (v *PrintGoStructVisitor) printMixedField(n *Node) {
+	if mixedFor(v.mixedContent, v.mixedElements, n) == MixedInnerXML {
+		v.lineChannel <- "\tInnerXML string `xml:\",innerxml\" json:\"innerxml,omitempty\"`"
+		return
+	}
+	v.lineChannel <- "\tNodes []" + v.typeName(n) + "Node `xml:\",any\" json:\"nodes,omitempty\"`"
+	v.usesMixedNodes = true
+}
+
+// printMixedNodeType writes the node type of n, held with MixedNodes, and
+// the methods reading and writing the content of n in order. A struct the
+// converter reads with a stack of its own gets no UnmarshalXML.
+func (v *PrintGoStructVisitor) printMixedNodeType(n *Node) {
+	name := v.typeName(n)
+	var fields, elements, children strings.Builder
+	// Unknown children go in a catch-all node, or are skipped.
+	unknown := "\treturn nil\n"
+	if hasCatchAll(v.catchAll, v.catchAllElements, n) {
+		fields.WriteString("\tAny *" + anyElementType + " `xml:\"-\" json:\"any,omitempty\"`\n")
+		elements.WriteString("\tcase n.Any != nil:\n\t\treturn n.Any, n.Any.XMLName\n")
+		unknown = "\tc := new(" + anyElementType + ")\n" +
+			"\tx.Nodes = append(x.Nodes, " + name + "Node{Any: c})\n" +
+			"\treturn c\n"
+		v.usesAnyElement = true
+	}
+	for _, localKey := range sortedChildKeys(n) {
+		child := n.Children[localKey]
+		field := child.MakeType(v.NamePrefix, v.NameSuffix)
+		fields.WriteString("\t" + field + " *" + v.typeName(child) + " `xml:\"-\" " + makeJsonAnnotation(child.spaceTag, v.nameSpaceInJsonName, child.Name) + "`\n")
+		elements.WriteString("\tcase n." + field + " != nil:\n")
+		elements.WriteString("\t\treturn n." + field + ", xml.Name{Space: " + strconv.Quote(child.Space) + ", Local: " + strconv.Quote(child.Name) + "}\n")
+		match := "t.Name.Local == " + strconv.Quote(child.Name)
+		if child.Space != "" {
+			match = "t.Name.Space == " + strconv.Quote(child.Space) + " && " + match
+		}
+		children.WriteString("\tcase " + match + ":\n")
+		children.WriteString("\t\tc := new(" + v.typeName(child) + ")\n")
+		children.WriteString("\t\tx.Nodes = append(x.Nodes, " + name + "Node{" + field + ": c})\n")
+		children.WriteString("\t\treturn c\n")
+	}
+	source := mixedNodeSource
+	if !v.nested[name] {
+		source += mixedUnmarshalSource
+	}
+	v.lineChannel <- strings.NewReplacer(
+		"NAME", name,
+		"ELEMENT", n.Name,
+		"\tFIELDS\n", fields.String(),
+		"\tELEMENTS\n", elements.String(),
+		"\tCHILDREN\n", children.String(),
+		"\tUNKNOWN\n", unknown,
+	).Replace(source)
+}
+
+const mixedNodeSource = `// NAMENode is a run of text or a child element of ELEMENT, which
+// mixes them.
+type NAMENode struct {
+	Text string ` + "`xml:\"-\" json:\"text,omitempty\"`" + `
+	FIELDS
+}
+
+func (n NAMENode) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if child, name := n.element(); child != nil {
+		return e.EncodeElement(child, xml.StartElement{Name: name})
+	}
+	return e.EncodeToken(xml.CharData(n.Text))
+}
+
+// element returns the child element of n and its name, or nil for a
+// run of text.
+func (n NAMENode) element() (interface{}, xml.Name) {
+	switch {
+	ELEMENTS
+	}
+	return nil, xml.Name{}
+}
+
+// addText adds text to the content of ELEMENT, to its last run if more.
+func (x *NAME) addText(text string, more bool) {
+	if more {
+		x.Nodes[len(x.Nodes)-1].Text += text
+		return
+	}
+	x.Nodes = append(x.Nodes, NAMENode{Text: text})
+}
+
+// addChild adds the child element t to the content of ELEMENT, and
+// returns it to read into, or nil if ELEMENT holds no such element.
+func (x *NAME) addChild(t xml.StartElement) interface{} {
+	switch {
+	CHILDREN
+	}
+	UNKNOWN
+}
+`
+
+const mixedUnmarshalSource = `
+// UnmarshalXML reads the attributes of ELEMENT as usual, and its
+// content in order.
+func (x *NAME) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plain NAME
+	tokens := mixedTokens{start, start.End()}
+	if err := xml.NewTokenDecoder(&tokens).Decode((*plain)(x)); err != nil {
+		return err
+	}
+	x.Nodes = nil
+	text := false
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			x.addText(string(t), text)
+			text = true
+		case xml.StartElement:
+			text = false
+			if child := x.addChild(t); child != nil {
+				err = d.DecodeElement(child, &t)
+			} else {
+				err = d.Skip()
+			}
+			if err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+`
+
+// printMixedTypes writes the helper of the node types, if used.
+func printMixedTypes(lineChannel chan string, used bool) {
+	if used {
+		lineChannel <- mixedTokensSource
+	}
+}
+
+const mixedTokensSource = `// mixedTokens replays the start and end of an element with mixed
+// content, so that its attributes decode apart from its content.
+type mixedTokens []xml.Token
+
+func (t *mixedTokens) Token() (xml.Token, error) {
+	if len(*t) == 0 {
+		return nil, io.EOF
+	}
+	token := (*t)[0]
+	*t = (*t)[1:]
+	return token, nil
+}
+`
@@ -0,0 +1,377 @@
+package chidleystein
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ModelVersion is the version of the JSON model written by WriteModel.
+// It goes up with every change to the layout of the model or of the type
+// evidence in it, since a field missing from an older model would read
+// back as evidence never seen: ReadModel refuses models of any other
+// version.
+const ModelVersion = 17
+
+type jsonModel struct {
+	Version    int                    `json:"version"`
+	Keying     string                 `json:"keying,omitempty"`
+	Root       []string               `json:"root"`
+	RootOccurs map[string]*jsonOccurs `json:"rootOccurs,omitempty"`
+	Documents  int                    `json:"documents,omitempty"`
+	FirstNode  string                 `json:"firstNode,omitempty"`
+	NameSpaces map[string]string      `json:"nameSpaces,omitempty"`
+	Nodes      []*jsonNode            `json:"nodes"`
+}
+
+type jsonNode struct {
+	Key             string                 `json:"key"`
+	Name            string                 `json:"name"`
+	Space           string                 `json:"space,omitempty"`
+	SpaceTag        string                 `json:"spaceTag,omitempty"`
+	Context         []string               `json:"context,omitempty"`
+	DiscoveredOrder int                    `json:"discoveredOrder"`
+	Repeats         bool                   `json:"repeats,omitempty"`
+	HasCharData     bool                   `json:"hasCharData,omitempty"`
+	Instances       int                    `json:"instances,omitempty"`
+	FirstAt         *Position              `json:"firstAt,omitempty"`
+	Comments        []string               `json:"comments,omitempty"`
+	Mixed           bool                   `json:"mixed,omitempty"`
+	Recursive       bool                   `json:"recursive,omitempty"`
+	Children        []string               `json:"children,omitempty"`
+	ChildOccurs     map[string]*jsonOccurs `json:"childOccurs,omitempty"`
+	Attributes      []*jsonFQN             `json:"attributes,omitempty"`
+	TypeInfo        *NodeTypeInfo          `json:"typeInfo"`
+}
+
+type jsonFQN struct {
+	Name     string        `json:"name"`
+	Space    string        `json:"space,omitempty"`
+	Present  int           `json:"present,omitempty"`
+	FirstAt  *Position     `json:"firstAt,omitempty"`
+	TypeInfo *NodeTypeInfo `json:"typeInfo"`
+}
+
+// jsonOccurs is an occurs keyed in its map by the child's node key.
+type jsonOccurs struct {
+	Present    int       `json:"present"`
+	MinPresent int       `json:"minPresent"`
+	Max        int       `json:"max"`
+	FirstAt    *Position `json:"firstAt,omitempty"`
+	Rank       int       `json:"rank"`
+	// Recursive is set if the child leads back to the parent; like
+	// jsonNode.Recursive, it is not read back.
+	Recursive bool `json:"recursive,omitempty"`
+	// Precedes holds the node keys of the children seen after this one.
+	Precedes []string `json:"precedes,omitempty"`
+}
+
+func childOccursModel(n *Node, r *recursion) map[string]*jsonOccurs {
+	m := make(map[string]*jsonOccurs, len(n.occurs))
+	for localKey, o := range n.occurs {
+		jo := &jsonOccurs{Present: o.present, MinPresent: o.minPresent, Max: o.max, FirstAt: positionOrNil(o.firstAt), Rank: o.rank, Recursive: r.leadsBack(n, n.Children[localKey])}
+		for next := range o.precedes {
+			jo.Precedes = append(jo.Precedes, nk(n.Children[next]))
+		}
+		sort.Strings(jo.Precedes)
+		m[nk(n.Children[localKey])] = jo
+	}
+	return m
+}
+
+// WriteModel writes the schema as a versioned JSON model that ReadModel
+// can load back.
+func (s *Schema) WriteModel(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s.ex.model())
+}
+
+// ReadModel loads a model written by WriteModel. It refuses models of a
+// version other than ModelVersion.
+func ReadModel(r io.Reader, opts Options) (*Schema, error) {
+	var m jsonModel
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+	ex, err := newExtractorFromModel(&m)
+	if err != nil {
+		return nil, err
+	}
+	ex.NamePrefix = opts.NamePrefix
+	ex.nameSuffix = opts.NameSuffix
+	ex.Debug = opts.Debug
+	ex.Progress = opts.Progress
+	ex.TimeLayouts = opts.TimeLayouts
+	ex.BoolVocabularies = opts.BoolVocabularies
+	ex.Strictness = opts.Strictness
+	ex.EnumLimit = opts.EnumLimit
+	opts.Keying = ex.Keying
+	return &Schema{Options: opts, ex: ex}, nil
+}
+
+// Merge folds the elements, attributes, namespaces and type evidence of o
+// into s. Elements already known to s keep their discovered order; new
+// ones are appended in the order o discovered them. Both schemas must
+// have been built with the same NodeKeying.
+func (s *Schema) Merge(o *Schema) error {
+	return s.ex.Merge(o.ex)
+}
+
+func (ex *Extractor) model() *jsonModel {
+	r := ex.recursion()
+	m := &jsonModel{
+		Version:    ModelVersion,
+		Keying:     ex.Keying.String(),
+		Root:       sortedChildNodeKeys(ex.Root),
+		RootOccurs: childOccursModel(ex.Root, r),
+		Documents:  ex.Root.instances,
+		NameSpaces: ex.NameSpaceTagMap,
+	}
+	if ex.FirstNode != nil {
+		m.FirstNode = nk(ex.FirstNode)
+	}
+	for _, n := range ex.nodesByDiscoveredOrder() {
+		key := nk(n)
+		jn := &jsonNode{
+			Key:             key,
+			Name:            n.Name,
+			Space:           n.Space,
+			SpaceTag:        n.spaceTag,
+			Context:         n.context,
+			DiscoveredOrder: n.DiscoveredOrder,
+			Repeats:         n.repeats,
+			HasCharData:     n.hasCharData,
+			Instances:       n.instances,
+			FirstAt:         positionOrNil(n.firstAt),
+			Comments:        n.comments,
+			Mixed:           n.mixed,
+			Children:        sortedChildNodeKeys(n),
+			ChildOccurs:     childOccursModel(n, r),
+			Recursive:       r.recursive(n),
+			TypeInfo:        n.nodeTypeInfo,
+		}
+		for _, fqn := range ex.GlobalTagAttributes[key] {
+			jn.Attributes = append(jn.Attributes, &jsonFQN{Name: fqn.name, Space: fqn.space, Present: fqn.present, FirstAt: positionOrNil(fqn.firstAt), TypeInfo: fqn.typeInfo})
+		}
+		m.Nodes = append(m.Nodes, jn)
+	}
+	return m
+}
+
+func newExtractorFromModel(m *jsonModel) (*Extractor, error) {
+	if m.Version != ModelVersion {
+		return nil, fmt.Errorf("chidley: unsupported model version %d (want %d); extract the model again from its XML", m.Version, ModelVersion)
+	}
+	ex := new(Extractor)
+	ex.init()
+	if m.Keying != "" {
+		keying, err := ParseNodeKeying(m.Keying)
+		if err != nil {
+			return nil, err
+		}
+		ex.Keying = keying
+	}
+	for uri, tag := range m.NameSpaces {
+		ex.NameSpaceTagMap[uri] = tag
+	}
+
+	for _, jn := range m.Nodes {
+		if _, ok := ex.GlobalNodeMap[jn.Key]; ok {
+			return nil, fmt.Errorf("chidley: duplicate model node %q", jn.Key)
+		}
+		n := new(Node)
+		n.initialize(jn.Name, jn.Space, jn.SpaceTag, nil)
+		n.key = jn.Key
+		n.context = jn.Context
+		n.DiscoveredOrder = jn.DiscoveredOrder
+		n.instances = jn.Instances
+		n.repeats = jn.Repeats
+		n.hasCharData = jn.HasCharData
+		if jn.FirstAt != nil {
+			n.firstAt = *jn.FirstAt
+		}
+		n.comments = jn.Comments
+		n.mixed = jn.Mixed
+		if jn.TypeInfo != nil {
+			n.nodeTypeInfo = jn.TypeInfo
+		}
+		if n.DiscoveredOrder > ex.discoveredOrder {
+			ex.discoveredOrder = n.DiscoveredOrder
+		}
+		ex.GlobalNodeMap[jn.Key] = n
+
+		ex.GlobalTagAttributes[jn.Key] = make([]*FQN, 0, len(jn.Attributes))
+		for _, ja := range jn.Attributes {
+			fqn := ex.addAttribute(jn.Key, n, xml.Name{Space: ja.Space, Local: ja.Name})
+			fqn.present = ja.Present
+			if ja.FirstAt != nil {
+				fqn.firstAt = *ja.FirstAt
+			}
+			if ja.TypeInfo != nil {
+				fqn.typeInfo = ja.TypeInfo
+			}
+		}
+	}
+
+	link := func(n *Node, keys []string, childOccurs map[string]*jsonOccurs) error {
+		for _, key := range keys {
+			child, ok := ex.GlobalNodeMap[key]
+			if !ok {
+				return fmt.Errorf("chidley: model refers to unknown node %q", key)
+			}
+			n.Children[child.localKey()] = child
+			o := new(occurs)
+			if jo, ok := childOccurs[key]; ok {
+				o.present, o.minPresent, o.max, o.rank = jo.Present, jo.MinPresent, jo.Max, jo.Rank
+				if jo.FirstAt != nil {
+					o.firstAt = *jo.FirstAt
+				}
+				for _, next := range jo.Precedes {
+					sibling, ok := ex.GlobalNodeMap[next]
+					if !ok {
+						return fmt.Errorf("chidley: model refers to unknown node %q", next)
+					}
+					o.precede(sibling.localKey())
+				}
+			}
+			n.occurs[child.localKey()] = o
+		}
+		return nil
+	}
+	for _, jn := range m.Nodes {
+		if err := link(ex.GlobalNodeMap[jn.Key], jn.Children, jn.ChildOccurs); err != nil {
+			return nil, err
+		}
+	}
+	if err := link(ex.Root, m.Root, m.RootOccurs); err != nil {
+		return nil, err
+	}
+	ex.Root.instances = m.Documents
+
+	if m.FirstNode != "" {
+		ex.FirstNode = ex.GlobalNodeMap[m.FirstNode]
+	}
+	if ex.FirstNode == nil {
+		return nil, errors.New("chidley: model has no document element")
+	}
+	return ex, nil
+}
+
+// Merge folds the model built by o into ex. o is left untouched.
+func (ex *Extractor) Merge(o *Extractor) error {
+	if ex.GlobalNodeMap == nil {
+		ex.init()
+	}
+	if ex.Keying != o.Keying {
+		return fmt.Errorf("chidley: cannot merge a model keyed by %s into one keyed by %s", o.Keying, ex.Keying)
+	}
+	for uri, tag := range o.NameSpaceTagMap {
+		if _, ok := ex.NameSpaceTagMap[uri]; !ok {
+			ex.NameSpaceTagMap[uri] = tag
+		}
+	}
+
+	nodes := o.nodesByDiscoveredOrder()
+	for _, on := range nodes {
+		key := nk(on)
+		n, ok := ex.GlobalNodeMap[key]
+		if ok {
+			n.nodeTypeInfo.merge(on.nodeTypeInfo)
+		} else {
+			n = new(Node)
+			n.initialize(on.Name, on.Space, on.spaceTag, nil)
+			n.key = key
+			n.context = on.context
+			ex.discoveredOrder += 1
+			n.DiscoveredOrder = ex.discoveredOrder
+			ex.GlobalNodeMap[key] = n
+			ex.GlobalTagAttributes[key] = make([]*FQN, 0, len(o.GlobalTagAttributes[key]))
+			n.nodeTypeInfo = on.nodeTypeInfo.clone()
+		}
+		n.instances += on.instances
+		n.repeats = n.repeats || on.repeats
+		n.hasCharData = n.hasCharData || on.hasCharData
+		n.mixed = n.mixed || on.mixed
+		n.firstAt.keepFirst(on.firstAt)
+		if len(n.comments) == 0 {
+			n.comments = on.comments
+		}
+
+		for _, fqn := range o.GlobalTagAttributes[key] {
+			a, ok := n.attributes[xml.Name{Space: fqn.space, Local: fqn.name}]
+			if ok {
+				a.typeInfo.merge(fqn.typeInfo)
+			} else {
+				a = ex.addAttribute(key, n, xml.Name{Space: fqn.space, Local: fqn.name})
+				a.typeInfo = fqn.typeInfo.clone()
+			}
+			a.present += fqn.present
+			a.firstAt.keepFirst(fqn.firstAt)
+		}
+	}
+
+	for _, on := range nodes {
+		ex.mergeChildren(ex.GlobalNodeMap[nk(on)], on)
+	}
+	ex.mergeChildren(ex.Root, o.Root)
+	ex.Root.instances += o.Root.instances
+	if ex.FirstNode == nil && o.FirstNode != nil {
+		ex.FirstNode = ex.GlobalNodeMap[nk(o.FirstNode)]
+	}
+	return nil
+}
+
+// mergeChildren links n to the nodes of ex matching the children of on,
+// a node of another Extractor, and adds up their occurrences.
+// The children new to n rank after its own, in their order in on.
+func (ex *Extractor) mergeChildren(n *Node, on *Node) {
+	for _, localKey := range on.childKeysByRank() {
+		child := on.Children[localKey]
+		n.Children[localKey] = ex.GlobalNodeMap[nk(child)]
+		o, ok := n.occurs[localKey]
+		if !ok {
+			o = &occurs{rank: len(n.occurs)}
+			n.occurs[localKey] = o
+		}
+		if oo, ok := on.occurs[localKey]; ok {
+			o.merge(oo)
+		}
+	}
+}
+
+func (ex *Extractor) nodesByDiscoveredOrder() []*Node {
+	nodes := make([]*Node, 0, len(ex.GlobalNodeMap))
+	for _, n := range ex.GlobalNodeMap {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].DiscoveredOrder != nodes[j].DiscoveredOrder {
+			return nodes[i].DiscoveredOrder < nodes[j].DiscoveredOrder
+		}
+		return nk(nodes[i]) < nk(nodes[j])
+	})
+	return nodes
+}
+
+func sortedChildKeys(n *Node) []string {
+	keys := make([]string, 0, len(n.Children))
+	for key := range n.Children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedChildNodeKeys returns the GlobalNodeMap keys of the children of n.
+func sortedChildNodeKeys(n *Node) []string {
+	keys := make([]string, 0, len(n.Children))
+	for _, child := range n.Children {
+		keys = append(keys, nk(child))
+	}
+	sort.Strings(keys)
+	return keys
+}
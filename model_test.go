@@ -0,0 +1,82 @@
+package chidleystein
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func roundTripModel(t *testing.T, s *Schema, opts Options) *Schema {
+	t.Helper()
+	var b bytes.Buffer
+	if err := s.WriteModel(&b); err != nil {
+		t.Fatal(err)
+	}
+	r, err := ReadModel(&b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestModelRoundTrip(t *testing.T) {
+	opts := DefaultOptions()
+	opts.UseType = true
+	opts.UseOccurs = true
+	opts.EnumLimit = 3
+	opts.Provenance = true
+
+	tests := []struct {
+		name string
+		xml  string
+	}{
+		{"types", `<r><n k="1">7</n><n k="2"></n><d>2006-01-02</d><b>Y</b><b>N</b></r>`},
+		{"occurs", `<r><a/><a/><b x="1"/></r>`},
+		{"enum", `<r><s>open</s><s>closed</s><s>open</s></r>`},
+		{"list", `<r><v>1 2 3</v><v>4</v></r>`},
+		{"mixed", `<r><p>a <i>b</i> c</p></r>`},
+		{"recursive", `<r><sec><sec><t>x</t></sec></sec></r>`},
+		{"namespaces", `<r xmlns:q="urn:q"><q:a q:k="v">1</q:a></r>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := inferString(t, tt.xml, opts)
+			want := goStructs(t, s)
+			if got := goStructs(t, roundTripModel(t, s, opts)); got != want {
+				t.Errorf("structs from the model differ:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestModelMerge(t *testing.T) {
+	opts := DefaultOptions()
+	opts.UseType = true
+	opts.UseOccurs = true
+
+	merged := roundTripModel(t, inferString(t, `<r><a n="v">1</a></r>`, opts), opts)
+	if err := merged.Merge(roundTripModel(t, inferString(t, `<r><a>x</a><b/></r>`, opts), opts)); err != nil {
+		t.Fatal(err)
+	}
+	got := goStructs(t, merged)
+	for _, want := range []string{
+		"\tAttr_n string `xml:\" n,attr,omitempty\"  json:\",omitempty\"`",
+		"\tText string `xml:\",chardata\" json:\",omitempty\"`",
+		"\tChia Chia `xml:\" a,omitempty\" json:\"a,omitempty\"`",
+		"\tChib *Chib `xml:\" b,omitempty\" json:\"b,omitempty\"`",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("no %q in merged structs:\n%s", want, got)
+		}
+	}
+}
+
+func TestReadModelVersion(t *testing.T) {
+	for _, version := range []int{ModelVersion - 1, ModelVersion + 1} {
+		model := fmt.Sprintf(`{"version": %d, "root": [], "nodes": []}`, version)
+		if _, err := ReadModel(strings.NewReader(model), DefaultOptions()); err == nil || !strings.Contains(err.Error(), "model version") {
+			t.Errorf("ReadModel(%s) = %v, want a version error", model, err)
+		}
+	}
+}
@@ -1,20 +1,35 @@
 package chidleystein
 
-//"log"
+import (
+	"encoding/xml"
+	"strings"
+)
 
 type Node struct {
-	Name            string
-	Space           string
-	spaceTag        string
-	parent          *Node
-	parents         []*Node
+	Name     string
+	Space    string
+	spaceTag string
+	// key is the node's GlobalNodeMap key; see NodeKeying.
+	key string
+	// context holds the ancestor names that went into key.
+	context []string
+	parent  *Node
+	// Children are keyed by nks(Space, Name) of the child, whatever the
+	// NodeKeying: under one parent, a name always maps to one node.
 	Children        map[string]*Node
-	childCount      map[string]int
+	occurs          map[string]*occurs
+	instances       int
+	attributes      map[xml.Name]*FQN
 	repeats         bool
 	nodeTypeInfo    *NodeTypeInfo
 	hasCharData     bool
-	tempCharData    string
 	DiscoveredOrder int
+	// firstAt is where the element was first seen.
+	firstAt Position
+	// comments are the XML comments right before its first occurrence.
+	comments []string
+	// mixed is set once an instance had both text and child elements.
+	mixed bool
 }
 
 type NodeVisitor interface {
@@ -25,18 +40,38 @@ type NodeVisitor interface {
 
 func (n *Node) initialize(name string, space string, spaceTag string, parent *Node) {
 	n.parent = parent
-	n.parents = make([]*Node, 0, 0)
-	n.pushParent(parent)
+	n.key = nks(space, name)
 	n.Name = name
 	n.Space = space
 	n.spaceTag = spaceTag
 	n.Children = make(map[string]*Node)
-	n.childCount = make(map[string]int)
+	n.occurs = make(map[string]*occurs)
+	n.attributes = make(map[xml.Name]*FQN)
 	n.nodeTypeInfo = new(NodeTypeInfo)
 	n.nodeTypeInfo.initialize()
 	n.hasCharData = false
 }
 
+// docLines returns the lines of the comments of n, trimmed, with an
+// empty line between two comments.
+func (n *Node) docLines() []string {
+	var lines []string
+	for _, comment := range n.comments {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		for _, line := range strings.Split(comment, "\n") {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	return lines
+}
+
+// localKey is the key of n in the Children map of its parents.
+func (n *Node) localKey() string {
+	return nks(n.Space, n.Name)
+}
+
 func (n *Node) makeName() string {
 	spaceTag := ""
 	if n.spaceTag != "" {
@@ -53,28 +88,6 @@ func (n *Node) makeJavaType(prefix string, suffix string) string {
 	return capitalizeFirstLetter(makeTypeGeneric(n.Name, n.spaceTag, prefix, suffix, true))
 }
 
-func (n *Node) peekParent() *Node {
-	if len(n.parents) == 0 {
-		return nil
-	}
-	a := n.parents
-	return a[len(a)-1]
-}
-
-func (n *Node) pushParent(parent *Node) {
-	n.parents = append(n.parents, parent)
-}
-
-func (n *Node) popParent() *Node {
-	if len(n.parents) == 0 {
-		return nil
-	}
-	var poppedNode *Node
-	a := n.parents
-	poppedNode, n.parents = a[len(a)-1], a[:len(a)-1]
-	return poppedNode
-}
-
 func makeTypeGeneric(name string, space string, prefix string, suffix string, capitalizeName bool) string {
 	spaceTag := ""
 	if space != "" {
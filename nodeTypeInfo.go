@@ -1,8 +1,12 @@
 package chidleystein
 
 import (
+	"encoding/json"
+	"errors"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type NodeTypeInfo struct {
@@ -20,6 +24,55 @@ type NodeTypeInfo struct {
 	alwaysUint16 bool
 	alwaysUint32 bool
 	alwaysUint64 bool
+
+	alwaysDateTime      bool
+	alwaysLocalDateTime bool
+	alwaysDate          bool
+	alwaysDateZone      bool
+	alwaysTime          bool
+	alwaysTimeZone      bool
+	alwaysDuration      bool
+
+	// layouts are the custom time layouts checked, see
+	// Options.TimeLayouts.
+	layouts []*layoutInfo
+	// boolVocabularies are the spellings of booleans checked, see
+	// Options.BoolVocabularies.
+	boolVocabularies []*boolVocabularyInfo
+
+	// example is the first value seen, and blocked the value that ruled
+	// out each type, by Go type name; exampleAt and blockedAt are where
+	// they were read.
+	example   string
+	exampleAt Position
+	blocked   map[string]string
+	blockedAt map[string]Position
+	// count counts the values that are not empty, and samples holds a
+	// few distinct ones, picked at random (see addSample).
+	count   int
+	samples []string
+	// absent counts the empty and xsi:nil values, which are no evidence
+	// for or against any type.
+	absent int
+
+	// values counts the distinct values seen, up to Options.EnumLimit;
+	// tooManyValues is set beyond.
+	values        map[string]int
+	tooManyValues bool
+
+	// list follows the values as lists of items; notList is set once
+	// they cannot be one.
+	list    *listInfo
+	notList bool
+
+	// padded is set once a value had significant whitespace around it,
+	// under xml:space="preserve": only a string keeps it.
+	padded bool
+}
+
+type layoutInfo struct {
+	layout string
+	always bool
 }
 
 func (nti *NodeTypeInfo) initialize() {
@@ -37,57 +90,485 @@ func (nti *NodeTypeInfo) initialize() {
 	nti.alwaysUint16 = true
 	nti.alwaysUint32 = true
 	nti.alwaysUint64 = true
+
+	nti.alwaysDateTime = true
+	nti.alwaysLocalDateTime = true
+	nti.alwaysDate = true
+	nti.alwaysDateZone = true
+	nti.alwaysTime = true
+	nti.alwaysTimeZone = true
+	nti.alwaysDuration = true
 }
 
-func (n *NodeTypeInfo) checkFieldType(v string) {
+// addLayouts makes nti check the custom time layouts too.
+func (nti *NodeTypeInfo) addLayouts(layouts []string) {
+	for _, layout := range layouts {
+		nti.layouts = append(nti.layouts, &layoutInfo{layout: layout, always: true})
+	}
+}
+
+// alwaysLayout reports whether all the values seen parse as layout.
+func (nti *NodeTypeInfo) alwaysLayout(layout string) bool {
+	for _, l := range nti.layouts {
+		if l.layout == layout {
+			return l.always
+		}
+	}
+	return false
+}
+
+// clone returns a copy of nti that can change on its own.
+func (nti *NodeTypeInfo) clone() *NodeTypeInfo {
+	c := *nti
+	c.values = nil
+	for v, count := range nti.values {
+		if c.values == nil {
+			c.values = make(map[string]int)
+		}
+		c.values[v] = count
+	}
+	c.blocked = nil
+	c.blockedAt = nil
+	for typeName, v := range nti.blocked {
+		c.setBlocked(typeName, v, nti.blockedAt[typeName])
+	}
+	c.samples = append([]string(nil), nti.samples...)
+	c.layouts = nil
+	for _, l := range nti.layouts {
+		c.layouts = append(c.layouts, &layoutInfo{layout: l.layout, always: l.always})
+	}
+	c.boolVocabularies = nil
+	for _, b := range nti.boolVocabularies {
+		c.boolVocabularies = append(c.boolVocabularies, &boolVocabularyInfo{vocabulary: b.vocabulary, always: b.always})
+	}
+	c.list = nti.list.clone()
+	return &c
+}
+
+// checkValue records v, a value of the field that is not empty, read at
+// at.
+func (nti *NodeTypeInfo) checkValue(v string, s Strictness, enumLimit int, at *Position) {
+	// Before checkFieldType: a list starts from the types of the values
+	// before v.
+	nti.checkList(v, s, enumLimit, at)
+	nti.checkFieldType(v, s, at)
+	if enumLimit > 0 {
+		nti.countValue(v, enumLimit)
+	}
+}
+
+// checkFieldType rules out the types v, read at at, does not fit,
+// spelled at strictness s, recording v as the value that blocked them.
+func (n *NodeTypeInfo) checkFieldType(v string, s Strictness, at *Position) {
 	v = strings.TrimSpace(v)
+	if n.example == "" {
+		n.example = v
+		n.exampleAt = *at
+	}
+	n.count += 1
+	n.addSample(v)
 
-	if _, err := strconv.ParseBool(v); err != nil {
-		n.alwaysBool = false
+	// Each check only runs while its type is still possible: most
+	// fields are ruled out of most types after a few values.
+	if n.alwaysBool {
+		if _, err := strconv.ParseBool(v); err != nil || !lexicalBool(v, s) {
+			n.block(&n.alwaysBool, GoBool, v, at)
+		}
+	}
+	for _, b := range n.boolVocabularies {
+		if b.always && v != b.vocabulary.True && v != b.vocabulary.False {
+			n.block(&b.always, boolVocabularyBlockKey(b.vocabulary), v, at)
+		}
 	}
 
-	if _, err := strconv.ParseFloat(v, 32); err != nil {
-		n.alwaysFloat32 = false
+	if n.alwaysFloat32 {
+		if _, err := strconv.ParseFloat(v, 32); err != nil || !lexicalFloat(v, s, 32) {
+			n.block(&n.alwaysFloat32, GoFloat32, v, at)
+		}
 	}
 
-	if _, err := strconv.ParseFloat(v, 64); err != nil {
-		n.alwaysFloat64 = false
+	if n.alwaysFloat64 {
+		if _, err := strconv.ParseFloat(v, 64); err != nil || !lexicalFloat(v, s, 64) {
+			n.block(&n.alwaysFloat64, GoFloat64, v, at)
+		}
 	}
 
-	if _, err := strconv.ParseInt(v, 10, 0); err != nil {
-		n.alwaysInt0 = false
+	if !lexicalInteger(v, s) {
+		n.block(&n.alwaysInt0, GoInt, v, at)
+		n.block(&n.alwaysInt08, GoInt8, v, at)
+		n.block(&n.alwaysInt16, GoInt16, v, at)
+		n.block(&n.alwaysInt32, GoInt32, v, at)
+		n.block(&n.alwaysInt64, GoInt64, v, at)
+		n.block(&n.alwaysUint08, GoUint8, v, at)
+		n.block(&n.alwaysUint16, GoUint16, v, at)
+		n.block(&n.alwaysUint32, GoUint32, v, at)
+		n.block(&n.alwaysUint64, GoUint64, v, at)
+	}
+
+	if n.alwaysInt0 {
+		if _, err := strconv.ParseInt(v, 10, 0); err != nil {
+			n.block(&n.alwaysInt0, GoInt, v, at)
+		}
+	}
+
+	if n.alwaysInt08 {
+		if _, err := strconv.ParseInt(v, 10, 8); err != nil {
+			n.block(&n.alwaysInt08, GoInt8, v, at)
+		}
+	}
+
+	if n.alwaysInt16 {
+		if _, err := strconv.ParseInt(v, 10, 16); err != nil {
+			n.block(&n.alwaysInt16, GoInt16, v, at)
+		}
+	}
+
+	if n.alwaysInt32 {
+		if _, err := strconv.ParseInt(v, 10, 32); err != nil {
+			n.block(&n.alwaysInt32, GoInt32, v, at)
+		}
+	}
+
+	if n.alwaysInt64 {
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+			n.block(&n.alwaysInt64, GoInt64, v, at)
+		}
+	}
+
+	// XML Schema allows "+1" for unsigned types; strconv does not.
+	u := v
+	if s == StrictnessXSD {
+		u = strings.TrimPrefix(v, "+")
+	}
+
+	if n.alwaysUint08 {
+		if _, err := strconv.ParseUint(u, 10, 8); err != nil {
+			n.block(&n.alwaysUint08, GoUint8, v, at)
+		}
+	}
+
+	if n.alwaysUint16 {
+		if _, err := strconv.ParseUint(u, 10, 16); err != nil {
+			n.block(&n.alwaysUint16, GoUint16, v, at)
+		}
+	}
+
+	if n.alwaysUint32 {
+		if _, err := strconv.ParseUint(u, 10, 32); err != nil {
+			n.block(&n.alwaysUint32, GoUint32, v, at)
+		}
+	}
+
+	if n.alwaysUint64 {
+		if _, err := strconv.ParseUint(u, 10, 64); err != nil {
+			n.block(&n.alwaysUint64, GoUint64, v, at)
+		}
+	}
+
+	if n.alwaysDateTime && !parsesAs(kindDateTime.layout, v) {
+		n.block(&n.alwaysDateTime, kindDateTime.name, v, at)
+	}
+	if n.alwaysLocalDateTime && !parsesAs(kindLocalDateTime.layout, v) {
+		n.block(&n.alwaysLocalDateTime, kindLocalDateTime.name, v, at)
+	}
+	if n.alwaysDate && !parsesAs(kindDate.layout, v) {
+		n.block(&n.alwaysDate, kindDate.name, v, at)
+	}
+	if n.alwaysDateZone && !parsesAs(kindDateZone.layout, v) {
+		n.block(&n.alwaysDateZone, kindDateZone.name, v, at)
+	}
+	if n.alwaysTime && !parsesAs(kindTime.layout, v) {
+		n.block(&n.alwaysTime, kindTime.name, v, at)
+	}
+	if n.alwaysTimeZone && !parsesAs(kindTimeZone.layout, v) {
+		n.block(&n.alwaysTimeZone, kindTimeZone.name, v, at)
 	}
+	if n.alwaysDuration {
+		if _, err := parseXsDuration(v); err != nil {
+			n.block(&n.alwaysDuration, kindDuration.name, v, at)
+		}
+	}
+	for _, l := range n.layouts {
+		if l.always && !parsesAs(l.layout, v) {
+			n.block(&l.always, layoutBlockKey(l.layout), v, at)
+		}
+	}
+}
 
-	if _, err := strconv.ParseInt(v, 10, 8); err != nil {
-		n.alwaysInt08 = false
+// block rules out the type typeName, held in always, because of v, read
+// at at.
+func (n *NodeTypeInfo) block(always *bool, typeName string, v string, at *Position) {
+	if !*always {
+		return
 	}
+	*always = false
+	n.setBlocked(typeName, v, *at)
+}
 
-	if _, err := strconv.ParseInt(v, 10, 16); err != nil {
-		n.alwaysInt16 = false
+func (n *NodeTypeInfo) setBlocked(typeName string, v string, at Position) {
+	if n.blocked == nil {
+		n.blocked = make(map[string]string)
 	}
+	if n.blockedAt == nil {
+		n.blockedAt = make(map[string]Position)
+	}
+	n.blocked[typeName] = v
+	n.blockedAt[typeName] = at
+}
+
+func layoutBlockKey(layout string) string {
+	return "layout " + layout
+}
+
+func parsesAs(layout, v string) bool {
+	_, err := time.Parse(layout, v)
+	return err == nil
+}
+
+// merge keeps only the types that hold for both n and o.
+func (n *NodeTypeInfo) merge(o *NodeTypeInfo) {
+	n.mergeList(o)
+
+	n.alwaysBool = n.alwaysBool && o.alwaysBool
+	n.alwaysFloat32 = n.alwaysFloat32 && o.alwaysFloat32
+	n.alwaysFloat64 = n.alwaysFloat64 && o.alwaysFloat64
+
+	n.alwaysInt0 = n.alwaysInt0 && o.alwaysInt0
+	n.alwaysInt08 = n.alwaysInt08 && o.alwaysInt08
+	n.alwaysInt16 = n.alwaysInt16 && o.alwaysInt16
+	n.alwaysInt32 = n.alwaysInt32 && o.alwaysInt32
+	n.alwaysInt64 = n.alwaysInt64 && o.alwaysInt64
+
+	n.alwaysUint08 = n.alwaysUint08 && o.alwaysUint08
+	n.alwaysUint16 = n.alwaysUint16 && o.alwaysUint16
+	n.alwaysUint32 = n.alwaysUint32 && o.alwaysUint32
+	n.alwaysUint64 = n.alwaysUint64 && o.alwaysUint64
 
-	if _, err := strconv.ParseInt(v, 10, 32); err != nil {
-		n.alwaysInt32 = false
+	n.alwaysDateTime = n.alwaysDateTime && o.alwaysDateTime
+	n.alwaysLocalDateTime = n.alwaysLocalDateTime && o.alwaysLocalDateTime
+	n.alwaysDate = n.alwaysDate && o.alwaysDate
+	n.alwaysDateZone = n.alwaysDateZone && o.alwaysDateZone
+	n.alwaysTime = n.alwaysTime && o.alwaysTime
+	n.alwaysTimeZone = n.alwaysTimeZone && o.alwaysTimeZone
+	n.alwaysDuration = n.alwaysDuration && o.alwaysDuration
+
+	// A layout o did not check has no evidence for it.
+	for _, l := range n.layouts {
+		l.always = l.always && o.alwaysLayout(l.layout)
+	}
+	for _, b := range n.boolVocabularies {
+		b.always = b.always && o.alwaysBoolVocabulary(b.vocabulary)
 	}
 
-	if _, err := strconv.ParseInt(v, 10, 64); err != nil {
-		n.alwaysInt64 = false
+	if n.example == "" {
+		n.example = o.example
+		n.exampleAt = o.exampleAt
 	}
+	n.absent += o.absent
+	n.padded = n.padded || o.padded
+	n.mergeSamples(o)
+	n.count += o.count
 
-	if _, err := strconv.ParseUint(v, 10, 8); err != nil {
-		n.alwaysUint08 = false
+	n.tooManyValues = n.tooManyValues || o.tooManyValues
+	if n.tooManyValues {
+		n.values = nil
+	} else {
+		for v, count := range o.values {
+			if n.values == nil {
+				n.values = make(map[string]int)
+			}
+			n.values[v] += count
+		}
 	}
+	for typeName, v := range o.blocked {
+		if _, ok := n.blocked[typeName]; !ok {
+			n.setBlocked(typeName, v, o.blockedAt[typeName])
+		}
+	}
+}
+
+// boolVocabularyJSON is the serialized form of boolVocabularyInfo; a list
+// keeps the order in which vocabularies are tried.
+type boolVocabularyJSON struct {
+	True   string `json:"true"`
+	False  string `json:"false"`
+	Always bool   `json:"always"`
+}
+
+// nodeTypeInfoJSON is the serialized form of NodeTypeInfo in models.
+type nodeTypeInfoJSON struct {
+	AlwaysBool    bool `json:"alwaysBool"`
+	AlwaysFloat32 bool `json:"alwaysFloat32"`
+	AlwaysFloat64 bool `json:"alwaysFloat64"`
+
+	AlwaysInt0  bool `json:"alwaysInt0"`
+	AlwaysInt08 bool `json:"alwaysInt08"`
+	AlwaysInt16 bool `json:"alwaysInt16"`
+	AlwaysInt32 bool `json:"alwaysInt32"`
+	AlwaysInt64 bool `json:"alwaysInt64"`
+
+	AlwaysUint08 bool `json:"alwaysUint08"`
+	AlwaysUint16 bool `json:"alwaysUint16"`
+	AlwaysUint32 bool `json:"alwaysUint32"`
+	AlwaysUint64 bool `json:"alwaysUint64"`
+
+	AlwaysDateTime      bool `json:"alwaysDateTime,omitempty"`
+	AlwaysLocalDateTime bool `json:"alwaysLocalDateTime,omitempty"`
+	AlwaysDate          bool `json:"alwaysDate,omitempty"`
+	AlwaysDateZone      bool `json:"alwaysDateZone,omitempty"`
+	AlwaysTime          bool `json:"alwaysTime,omitempty"`
+	AlwaysTimeZone      bool `json:"alwaysTimeZone,omitempty"`
+	AlwaysDuration      bool `json:"alwaysDuration,omitempty"`
+
+	Layouts          map[string]bool      `json:"layouts,omitempty"`
+	BoolVocabularies []boolVocabularyJSON `json:"boolVocabularies,omitempty"`
+
+	Example string            `json:"example,omitempty"`
+	Blocked map[string]string `json:"blocked,omitempty"`
+
+	ExampleAt *Position           `json:"exampleAt,omitempty"`
+	BlockedAt map[string]Position `json:"blockedAt,omitempty"`
+	Count     int                 `json:"count,omitempty"`
+	Samples   []string            `json:"samples,omitempty"`
+	Absent    int                 `json:"absent,omitempty"`
 
-	if _, err := strconv.ParseUint(v, 10, 16); err != nil {
-		n.alwaysUint16 = false
+	Values        map[string]int `json:"values,omitempty"`
+	TooManyValues bool           `json:"tooManyValues,omitempty"`
+
+	List    *listInfoJSON `json:"list,omitempty"`
+	NotList bool          `json:"notList,omitempty"`
+
+	Padded bool `json:"padded,omitempty"`
+}
+
+// listInfoJSON is the serialized form of listInfo.
+type listInfoJSON struct {
+	Items     *NodeTypeInfo `json:"items"`
+	Parts     *NodeTypeInfo `json:"parts"`
+	TupleSize int           `json:"tupleSize"`
+	Spaced    bool          `json:"spaced,omitempty"`
+}
+
+func (n *NodeTypeInfo) MarshalJSON() ([]byte, error) {
+	j := nodeTypeInfoJSON{
+		AlwaysBool:    n.alwaysBool,
+		AlwaysFloat32: n.alwaysFloat32,
+		AlwaysFloat64: n.alwaysFloat64,
+
+		AlwaysInt0:  n.alwaysInt0,
+		AlwaysInt08: n.alwaysInt08,
+		AlwaysInt16: n.alwaysInt16,
+		AlwaysInt32: n.alwaysInt32,
+		AlwaysInt64: n.alwaysInt64,
+
+		AlwaysUint08: n.alwaysUint08,
+		AlwaysUint16: n.alwaysUint16,
+		AlwaysUint32: n.alwaysUint32,
+		AlwaysUint64: n.alwaysUint64,
+
+		AlwaysDateTime:      n.alwaysDateTime,
+		AlwaysLocalDateTime: n.alwaysLocalDateTime,
+		AlwaysDate:          n.alwaysDate,
+		AlwaysDateZone:      n.alwaysDateZone,
+		AlwaysTime:          n.alwaysTime,
+		AlwaysTimeZone:      n.alwaysTimeZone,
+		AlwaysDuration:      n.alwaysDuration,
+
+		Example: n.example,
+		Blocked: n.blocked,
+
+		BlockedAt: n.blockedAt,
+		Count:     n.count,
+		Samples:   n.samples,
+		Absent:    n.absent,
+
+		Values:        n.values,
+		TooManyValues: n.tooManyValues,
+
+		NotList: n.notList,
+
+		Padded: n.padded,
+	}
+	if n.example != "" {
+		j.ExampleAt = &n.exampleAt
+	}
+	if l := n.list; l != nil {
+		j.List = &listInfoJSON{Items: l.items, Parts: l.parts, TupleSize: l.tupleSize, Spaced: l.spaced}
+	}
+	if len(n.layouts) > 0 {
+		j.Layouts = make(map[string]bool, len(n.layouts))
+		for _, l := range n.layouts {
+			j.Layouts[l.layout] = l.always
+		}
 	}
+	for _, b := range n.boolVocabularies {
+		j.BoolVocabularies = append(j.BoolVocabularies, boolVocabularyJSON{True: b.vocabulary.True, False: b.vocabulary.False, Always: b.always})
+	}
+	return json.Marshal(j)
+}
 
-	if _, err := strconv.ParseUint(v, 10, 32); err != nil {
-		n.alwaysUint32 = false
+func (n *NodeTypeInfo) UnmarshalJSON(b []byte) error {
+	var j nodeTypeInfoJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
 	}
+	n.alwaysBool = j.AlwaysBool
+	n.alwaysFloat32 = j.AlwaysFloat32
+	n.alwaysFloat64 = j.AlwaysFloat64
+
+	n.alwaysInt0 = j.AlwaysInt0
+	n.alwaysInt08 = j.AlwaysInt08
+	n.alwaysInt16 = j.AlwaysInt16
+	n.alwaysInt32 = j.AlwaysInt32
+	n.alwaysInt64 = j.AlwaysInt64
 
-	if _, err := strconv.ParseUint(v, 10, 64); err != nil {
-		n.alwaysUint64 = false
+	n.alwaysUint08 = j.AlwaysUint08
+	n.alwaysUint16 = j.AlwaysUint16
+	n.alwaysUint32 = j.AlwaysUint32
+	n.alwaysUint64 = j.AlwaysUint64
+
+	n.alwaysDateTime = j.AlwaysDateTime
+	n.alwaysLocalDateTime = j.AlwaysLocalDateTime
+	n.alwaysDate = j.AlwaysDate
+	n.alwaysDateZone = j.AlwaysDateZone
+	n.alwaysTime = j.AlwaysTime
+	n.alwaysTimeZone = j.AlwaysTimeZone
+	n.alwaysDuration = j.AlwaysDuration
+
+	n.example = j.Example
+	n.blocked = j.Blocked
+	n.blockedAt = j.BlockedAt
+	n.exampleAt = Position{}
+	if j.ExampleAt != nil {
+		n.exampleAt = *j.ExampleAt
+	}
+	n.count = j.Count
+	n.samples = j.Samples
+	n.absent = j.Absent
+	n.values = j.Values
+	n.tooManyValues = j.TooManyValues
+	n.notList = j.NotList
+	n.padded = j.Padded
+	n.list = nil
+	if l := j.List; l != nil {
+		if l.Items == nil || l.Parts == nil {
+			return errors.New("chidley: list without items or parts")
+		}
+		n.list = &listInfo{items: l.Items, parts: l.Parts, tupleSize: l.TupleSize, spaced: l.Spaced}
 	}
 
+	var layouts []string
+	for layout := range j.Layouts {
+		layouts = append(layouts, layout)
+	}
+	sort.Strings(layouts)
+	n.layouts = nil
+	for _, layout := range layouts {
+		n.layouts = append(n.layouts, &layoutInfo{layout: layout, always: j.Layouts[layout]})
+	}
+	n.boolVocabularies = nil
+	for _, b := range j.BoolVocabularies {
+		n.boolVocabularies = append(n.boolVocabularies, &boolVocabularyInfo{vocabulary: BoolVocabulary{True: b.True, False: b.False}, always: b.Always})
+	}
+	return nil
 }
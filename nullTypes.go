@@ -0,0 +1,153 @@
+package chidleystein
+
+import (
+	"sort"
+	"strings"
+)
+
+// nullKind is a generated type holding a value of goType, or null when
+// the text is empty, as in an element with xsi:nil="true".
+type nullKind struct {
+	name   string
+	field  string
+	goType string
+	// parse and format are Go expressions converting the text s to
+	// goType, with an error, and the goType v back to a string. They are
+	// empty for types with their own text methods.
+	parse, format string
+}
+
+var nullKinds = map[string]*nullKind{
+	GoBool:    {field: "Bool", parse: "strconv.ParseBool(s)", format: "strconv.FormatBool(v)"},
+	GoInt:     {field: "Int", parse: "strconv.ParseInt(s, 10, 0)", format: "strconv.FormatInt(int64(v), 10)"},
+	GoInt8:    {field: "Int8", parse: "strconv.ParseInt(s, 10, 8)", format: "strconv.FormatInt(int64(v), 10)"},
+	GoInt16:   {field: "Int16", parse: "strconv.ParseInt(s, 10, 16)", format: "strconv.FormatInt(int64(v), 10)"},
+	GoInt32:   {field: "Int32", parse: "strconv.ParseInt(s, 10, 32)", format: "strconv.FormatInt(int64(v), 10)"},
+	GoInt64:   {field: "Int64", parse: "strconv.ParseInt(s, 10, 64)", format: "strconv.FormatInt(v, 10)"},
+	GoUint8:   {field: "Uint8", parse: "strconv.ParseUint(s, 10, 8)", format: "strconv.FormatUint(uint64(v), 10)"},
+	GoUint16:  {field: "Uint16", parse: "strconv.ParseUint(s, 10, 16)", format: "strconv.FormatUint(uint64(v), 10)"},
+	GoUint32:  {field: "Uint32", parse: "strconv.ParseUint(s, 10, 32)", format: "strconv.FormatUint(uint64(v), 10)"},
+	GoUint64:  {field: "Uint64", parse: "strconv.ParseUint(s, 10, 64)", format: "strconv.FormatUint(v, 10)"},
+	GoFloat32: {field: "Float32", parse: "strconv.ParseFloat(s, 32)", format: "strconv.FormatFloat(float64(v), 'g', -1, 32)"},
+	GoFloat64: {field: "Float64", parse: "strconv.ParseFloat(s, 64)", format: "strconv.FormatFloat(v, 'g', -1, 64)"},
+	GoTime:    {field: "Time"},
+}
+
+// nullKindOf returns the nullable type for goType, a type returned by
+// findType other than string.
+func nullKindOf(goType string) *nullKind {
+	k, ok := nullKinds[goType]
+	if !ok {
+		// A generated date, time or duration type.
+		k = &nullKind{field: goType}
+	}
+	return &nullKind{name: "Null" + k.field, field: k.field, goType: goType, parse: k.parse, format: k.format}
+}
+
+// nullTypeNames returns the names of all the nullable types that may be
+// generated, so that no struct takes them.
+func nullTypeNames(layouts []string) []string {
+	var names []string
+	for _, k := range nullKinds {
+		names = append(names, "Null"+k.field)
+	}
+	for _, name := range timeTypeNames(layouts) {
+		names = append(names, "Null"+name)
+	}
+	return names
+}
+
+// isNullable reports whether the values seen by nti were sometimes
+// missing, so that a typed field must be able to hold null.
+func (nti *NodeTypeInfo) isNullable() bool {
+	return nti.absent > 0
+}
+
+// printNullTypes writes the types generated for kinds.
+func printNullTypes(lineChannel chan string, kinds map[string]*nullKind) {
+	var names []string
+	for name := range kinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lineChannel <- nullTypeSource(kinds[name])
+	}
+}
+
+func nullTypeSource(k *nullKind) string {
+	source := nullTextSource
+	if k.parse != "" {
+		source = nullParseSource
+	}
+	return strings.NewReplacer("NAME", k.name, "FIELD", k.field, "GOTYPE", k.goType, "PARSE", k.parse, "FORMAT", k.format).Replace(source)
+}
+
+const nullParseSource = `// NAME is a GOTYPE that may be null: empty text, as in an element with
+// xsi:nil="true", reads as null and null is written as empty text.
+type NAME struct {
+	FIELD GOTYPE
+	Valid bool
+}
+
+func (n NAME) MarshalText() ([]byte, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	v := n.FIELD
+	return []byte(FORMAT), nil
+}
+
+func (n *NAME) UnmarshalText(b []byte) error {
+	s := strings.TrimSpace(string(b))
+	if s == "" {
+		*n = NAME{}
+		return nil
+	}
+	v, err := PARSE
+	if err != nil {
+		return err
+	}
+	*n = NAME{FIELD: GOTYPE(v), Valid: true}
+	return nil
+}
+
+func (n NAME) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(n.FIELD)
+}
+`
+
+const nullTextSource = `// NAME is a GOTYPE that may be null: empty text, as in an element with
+// xsi:nil="true", reads as null and null is written as empty text.
+type NAME struct {
+	FIELD GOTYPE
+	Valid bool
+}
+
+func (n NAME) MarshalText() ([]byte, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.FIELD.MarshalText()
+}
+
+func (n *NAME) UnmarshalText(b []byte) error {
+	s := strings.TrimSpace(string(b))
+	if s == "" {
+		*n = NAME{}
+		return nil
+	}
+	*n = NAME{Valid: true}
+	return n.FIELD.UnmarshalText([]byte(s))
+}
+
+func (n NAME) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(n.FIELD)
+}
+`
@@ -0,0 +1,96 @@
+package chidleystein
+
+// occurs counts how often a child element appears in the instances of
+// its parent.
+type occurs struct {
+	// present is the number of parent instances holding the child.
+	present int
+	// minPresent and max are the fewest and most occurrences of the
+	// child in one parent instance holding it.
+	minPresent int
+	max        int
+	// firstAt is where the child was first seen in the parent.
+	firstAt Position
+	// rank is the number of children of the parent seen before this one.
+	rank int
+	// precedes holds the children seen after this one in some instance
+	// of the parent.
+	precedes map[string]bool
+}
+
+// add records one parent instance holding the child count times.
+func (o *occurs) add(count int) {
+	if o.present == 0 || count < o.minPresent {
+		o.minPresent = count
+	}
+	if count > o.max {
+		o.max = count
+	}
+	o.present += 1
+}
+
+// precede records that the child of localKey followed this one.
+func (o *occurs) precede(localKey string) {
+	if o.precedes == nil {
+		o.precedes = make(map[string]bool)
+	}
+	o.precedes[localKey] = true
+}
+
+func (o *occurs) merge(p *occurs) {
+	o.firstAt.keepFirst(p.firstAt)
+	for localKey := range p.precedes {
+		o.precede(localKey)
+	}
+	if p.present == 0 {
+		return
+	}
+	if o.present == 0 || p.minPresent < o.minPresent {
+		o.minPresent = p.minPresent
+	}
+	if p.max > o.max {
+		o.max = p.max
+	}
+	o.present += p.present
+}
+
+// Instances returns the number of times the element of n was seen.
+func (n *Node) Instances() int {
+	return n.instances
+}
+
+// ChildOccurs returns the fewest and most times child was seen in one
+// instance of n, like minOccurs and maxOccurs in XML Schema.
+func (n *Node) ChildOccurs(child *Node) (minOccurs, maxOccurs int) {
+	o, ok := n.occurs[child.localKey()]
+	if !ok {
+		return 0, 0
+	}
+	if o.present < n.instances {
+		return 0, o.max
+	}
+	return o.minPresent, o.max
+}
+
+// AttributeOccurs returns 1, 1 if the attribute fqn was on every instance
+// of n, and 0, 1 otherwise.
+func (n *Node) AttributeOccurs(fqn *FQN) (minOccurs, maxOccurs int) {
+	if fqn.present < n.instances || n.instances == 0 {
+		return 0, 1
+	}
+	return 1, 1
+}
+
+// isRequired reports whether child appears exactly once in every
+// instance of n.
+func (n *Node) isRequired(child *Node) bool {
+	minOccurs, maxOccurs := n.ChildOccurs(child)
+	return minOccurs == 1 && maxOccurs == 1
+}
+
+// isRepeated reports whether child appears more than once in some
+// instance of n.
+func (n *Node) isRepeated(child *Node) bool {
+	_, maxOccurs := n.ChildOccurs(child)
+	return maxOccurs > 1
+}
@@ -8,6 +8,7 @@ type PrintGoStructVisitor struct {
 	NamePrefix          string
 	NameSuffix          string
 	AttributePrefix     string
+	AddDbMetadata       bool
 	AlreadyVisited      map[string]bool
 	AlreadyVisitedNodes map[string]*Node
 	globalTagAttributes map[string]([]*FQN)
@@ -17,6 +18,44 @@ type PrintGoStructVisitor struct {
 	nameSpaceTagMap     map[string]string
 	useType             bool
 	nameSpaceInJsonName bool
+	useOccurs           bool
+	typePolicy          TypePolicy
+	fieldTypePolicies   map[string]TypePolicy
+	timeLayouts         []string
+	// timeTypes are the date, time and duration types used by fields.
+	timeTypes   map[string]*timeKind
+	usesTime    bool
+	nullTypes   map[string]*nullKind
+	enumLimit   int
+	strictEnums bool
+	enums       map[string]*enumType
+	boolTypes   map[string]BoolVocabulary
+	tupleFields map[string][]string
+	listItems   map[string]*listItem
+	tuples      map[string]*tupleType
+	lists       map[string]*listType
+	namer       *typeNamer
+	// recursion holds the structs leading back to themselves.
+	recursion *recursion
+	// nested holds the structs the converter reads and writes with a
+	// stack of its own, see Schema.nestedTypes.
+	nested map[string]bool
+	// provenance adds a comment saying where each struct and field was
+	// first seen.
+	provenance bool
+	// samples adds a comment with sample values to text and attribute
+	// fields.
+	samples SampleComments
+	// mixedContent and mixedElements choose the fields of the elements
+	// with mixed content, see Options.MixedContent.
+	mixedContent   MixedContent
+	mixedElements  map[string]MixedContent
+	usesMixedNodes bool
+	// catchAll and catchAllElements choose the structs getting catch-all
+	// fields, see Options.CatchAll.
+	catchAll         bool
+	catchAllElements map[string]bool
+	usesAnyElement   bool
 }
 
 func (v *PrintGoStructVisitor) Init(lineChannel chan string, maxDepth int, globalTagAttributes map[string]([]*FQN), nameSpaceTagMap map[string]string, useType bool, nameSpaceInJsonName bool) {
@@ -49,26 +88,76 @@ func (v *PrintGoStructVisitor) Visit(node *Node) bool {
 }
 
 func (v *PrintGoStructVisitor) Print(node *Node) {
+	if v.namer != nil && !v.namer.isCanonical(node) {
+		return
+	}
 	attributes := v.globalTagAttributes[nk(node)]
-	v.lineChannel <- "type " + node.MakeType(v.NamePrefix, v.NameSuffix) + " struct {"
-	makeAttributes(v.lineChannel, v.AttributePrefix, attributes, v.nameSpaceTagMap)
-	v.printInternalFields(node)
-	if node.Space != "" {
+	for _, line := range node.docLines() {
+		if line == "" {
+			v.lineChannel <- "//"
+		} else {
+			v.lineChannel <- "// " + line
+		}
+	}
+	v.comment("", v.provenanceOf(node.Name, node.firstAt))
+	v.lineChannel <- "type " + v.typeName(node) + " struct {"
+	v.printAttributes(node, attributes)
+	if node.mixed {
+		v.printMixedField(node)
+	} else {
+		v.printInternalFields(node)
+	}
+	if hasCatchAll(v.catchAll, v.catchAllElements, node) {
+		v.printCatchAllFields(node)
+	}
+	// A shared struct is decoded under several element names, so its
+	// name comes from the field tags of the parents.
+	if node.Space != "" && (v.namer == nil || !v.namer.isShared(node)) {
 		v.lineChannel <- "\tXMLName  xml.Name `" + makeXmlAnnotation(node.Space, false, node.Name) + " " + makeJsonAnnotation(node.spaceTag, false, node.Name) + "`"
 	}
 	v.lineChannel <- "}\n"
+	if node.mixed && mixedFor(v.mixedContent, v.mixedElements, node) == MixedNodes {
+		v.printMixedNodeType(node)
+	}
 }
 
-func print(v *PrintGoStructVisitor, node *Node) {
-	attributes := v.globalTagAttributes[nk(node)]
-	v.lineChannel <- "type " + node.MakeType(v.NamePrefix, v.NameSuffix) + " struct {"
-	makeAttributes(v.lineChannel, v.AttributePrefix, attributes, v.nameSpaceTagMap)
-	v.printInternalFields(node)
-	if node.Space != "" {
-		v.lineChannel <- "\tXMLName  xml.Name `" + makeXmlAnnotation(node.Space, false, node.Name) + " " + makeJsonAnnotation(node.spaceTag, false, node.Name) + "`"
+// childPath names child in n for comments; the document elements are
+// children of Extractor.Root, which is no element.
+func childPath(n *Node, child *Node) string {
+	if n.key == rootKey {
+		return child.Name
 	}
-	v.lineChannel <- "}\n"
+	return n.Name + "/" + child.Name
+}
 
+// comment writes each text that is not empty as a comment line indented
+// by indent.
+func (v *PrintGoStructVisitor) comment(indent string, texts ...string) {
+	for _, text := range texts {
+		if text != "" {
+			v.lineChannel <- indent + "// " + text
+		}
+	}
+}
+
+// provenanceOf returns the provenance comment of what, if asked for.
+func (v *PrintGoStructVisitor) provenanceOf(what string, p Position) string {
+	if !v.provenance {
+		return ""
+	}
+	return provenance(what, p)
+}
+
+func print(v *PrintGoStructVisitor, node *Node) {
+	v.Print(node)
+}
+
+// typeName returns the name of the struct generated for n.
+func (v *PrintGoStructVisitor) typeName(n *Node) string {
+	if v.namer != nil {
+		return v.namer.typeName(n)
+	}
+	return n.MakeType(v.NamePrefix, v.NameSuffix)
 }
 
 func (v *PrintGoStructVisitor) IsAlreadyVisited(n *Node) bool {
@@ -81,25 +170,142 @@ func (v *PrintGoStructVisitor) SetAlreadyVisited(n *Node) {
 	v.AlreadyVisitedNodes[nk(n)] = n
 }
 
+// fieldType returns the Go type of field, and notes the date, time,
+// duration, boolean, nullable, enumeration and list types to generate.
+// The enumeration and tuple types of the field are named after name.
+func (v *PrintGoStructVisitor) fieldType(nti *NodeTypeInfo, field string, name string) string {
+	policy := policyFor(v.typePolicy, v.fieldTypePolicies, field)
+	t := findType(nti, v.useType, policy, v.timeLayouts)
+	if values := nti.enumValues(v.enumLimit); t == "string" && values != nil {
+		return v.enum(name+"Enum", values)
+	}
+	if t == "string" && v.useType {
+		if shape := nti.listShape(policy, v.timeLayouts, v.enumLimit); shape != nil {
+			return v.listType(shape, field, name)
+		}
+	}
+	v.noteType(nti, t)
+	if t != "string" && nti.isNullable() {
+		k := nullKindOf(t)
+		if v.nullTypes == nil {
+			v.nullTypes = make(map[string]*nullKind)
+		}
+		v.nullTypes[k.name] = k
+		return k.name
+	}
+	return t
+}
+
+// derivedName returns the name of a type named after another, like an
+// enumeration, free of the names of all other types.
+func (v *PrintGoStructVisitor) derivedName(name string) string {
+	if v.namer != nil {
+		return v.namer.reserved.derive(name)
+	}
+	return name
+}
+
+// enum notes the enumeration type of values, named after name, and
+// returns its name.
+func (v *PrintGoStructVisitor) enum(name string, values []string) string {
+	name = v.derivedName(name)
+	if v.enums == nil {
+		v.enums = make(map[string]*enumType)
+	}
+	v.enums[name] = &enumType{name: name, values: values, strict: v.strictEnums}
+	return name
+}
+
+// listType returns the list type of shape, noting it and the types of
+// its items to generate.
+func (v *PrintGoStructVisitor) listType(shape *listShape, field string, name string) string {
+	item := shape.itemType
+	if shape.enumValues != nil {
+		item = v.enum(name+"Enum", shape.enumValues)
+	} else {
+		v.noteType(shape.item, item)
+	}
+	if v.listItems == nil {
+		v.listItems = make(map[string]*listItem)
+		v.tuples = make(map[string]*tupleType)
+		v.lists = make(map[string]*listType)
+	}
+	v.listItems[item] = &listItem{goType: item, enum: v.enums[item]}
+	if shape.tupleSize > 0 {
+		tuple := &tupleType{name: v.derivedName(name + "Tuple"), part: item, fields: tupleFieldNames(v.tupleFields, field, shape.tupleSize)}
+		v.tuples[tuple.name] = tuple
+		item = tuple.name
+		v.listItems[item] = &listItem{goType: item}
+	}
+	l := &listType{name: listTypeName(item, shape.separator), item: item, separator: shape.separator}
+	if item != shape.itemType {
+		// Lists of built-in types have reserved names, lists of
+		// enumerations and tuples are named after them.
+		l.name = v.derivedName(l.name)
+	}
+	v.lists[l.name] = l
+	return l.name
+}
+
+// noteType notes the date, time, duration or boolean type t of the
+// values seen by nti, if it is one, to generate.
+func (v *PrintGoStructVisitor) noteType(nti *NodeTypeInfo, t string) {
+	if t == GoTime {
+		v.usesTime = true
+	} else if k := nti.timeKind(v.timeLayouts); k != nil && k.name == t {
+		if v.timeTypes == nil {
+			v.timeTypes = make(map[string]*timeKind)
+		}
+		v.timeTypes[t] = k
+	} else if b := nti.boolVocabulary(); b != nil && b.typeName() == t {
+		if v.boolTypes == nil {
+			v.boolTypes = make(map[string]BoolVocabulary)
+		}
+		v.boolTypes[t] = *b
+	}
+}
+
+// printAttributes writes the attribute fields of the struct for n. The
+// attributes missing from some instances, such as xsi:nil, are omitempty,
+// so that they are not written back empty or false.
+func (v *PrintGoStructVisitor) printAttributes(n *Node, attributes []*FQN) {
+	sort.Sort(fqnSorter(attributes))
+
+	for _, fqn := range attributes {
+		name := fqn.name
+		space := fqn.space
+
+		spaceTag, ok := v.nameSpaceTagMap[space]
+		if ok && spaceTag != "" {
+			spaceTag = spaceTag + "_"
+		}
+
+		attr := ",attr"
+		if minOccurs, _ := n.AttributeOccurs(fqn); minOccurs == 0 {
+			attr += ",omitempty"
+		}
+		fieldType := v.fieldType(fqn.typeInfo, attributeField(n, fqn), v.typeName(n)+"_"+identifier(fqn.name))
+		v.comment("\t", sampleComment(fqn.typeInfo, v.samples), v.provenanceOf(n.Name+"@"+name, fqn.firstAt))
+		v.lineChannel <- "\t" + v.AttributePrefix + spaceTag + cleanName(name) + " " + fieldType + " `xml:\"" + space + " " + name + attr + "\"  json:\",omitempty\"`"
+	}
+}
+
+// printInternalFields writes the fields of the children of n, in the
+// order of its content model, then that of its text.
 func (pn *PrintGoStructVisitor) printInternalFields(n *Node) {
 	var fields []string
+	// comments holds the comments of each field, by field.
+	comments := make(map[string][]string)
 
 	var field string
 
-	for i, _ := range n.Children {
-		v := n.Children[i]
-		field = "\t" + v.MakeType(pn.NamePrefix, pn.NameSuffix) + " "
-		if v.repeats {
-			field += "[]*"
-		} else {
-			field += "*"
-		}
-		field += v.MakeType(pn.NamePrefix, pn.NameSuffix)
+	for _, v := range n.contentChildren() {
+		field = "\t" + v.MakeType(pn.NamePrefix, pn.NameSuffix) + " " + pn.fieldShape(n, v) + pn.typeName(v)
 
 		jsonAnnotation := makeJsonAnnotation(v.spaceTag, pn.nameSpaceInJsonName, v.Name)
 		xmlAnnotation := makeXmlAnnotation(v.Space, false, v.Name)
 		dbAnnotation := ""
-		if addDbMetadata {
+		if pn.AddDbMetadata {
 			dbAnnotation = " " + makeDbAnnotation(v.Space, false, v.Name)
 		}
 
@@ -107,19 +313,42 @@ func (pn *PrintGoStructVisitor) printInternalFields(n *Node) {
 
 		field += annotation
 		fields = append(fields, field)
+		if o, ok := n.occurs[v.localKey()]; ok {
+			comments[field] = []string{pn.provenanceOf(childPath(n, v), o.firstAt)}
+		}
 	}
 
 	if n.hasCharData {
 		xmlString := " `xml:\",chardata\" " + makeJsonAnnotation("", false, "") + "`"
-		charField := "\t" + "Text" + " " + findType(n.nodeTypeInfo, useType) + xmlString
+		charField := "\t" + "Text" + " " + pn.fieldType(n.nodeTypeInfo, textField(n), pn.typeName(n)) + xmlString
 		fields = append(fields, charField)
+		comments[charField] = []string{sampleComment(n.nodeTypeInfo, pn.samples), pn.provenanceOf(n.Name+" text", n.nodeTypeInfo.exampleAt)}
 	}
-	sort.Strings(fields)
 	for i := 0; i < len(fields); i++ {
+		pn.comment("\t", comments[fields[i]]...)
 		pn.lineChannel <- fields[i]
 	}
 }
 
+// fieldShape returns what goes before the type of the field of n holding
+// child: "[]*" for a repeated child and "*" for an optional one. With
+// useOccurs, a child seen exactly once in every instance of n is held by
+// value, unless its struct leads back to that of n: a recursive child is
+// always held through a pointer or a slice.
+func (pn *PrintGoStructVisitor) fieldShape(n *Node, child *Node) string {
+	repeated := child.repeats
+	if pn.useOccurs {
+		repeated = n.isRepeated(child)
+	}
+	switch {
+	case repeated:
+		return "[]*"
+	case pn.useOccurs && n.isRequired(child) && !pn.recursion.leadsBack(n, child):
+		return ""
+	}
+	return "*"
+}
+
 func makeJsonAnnotation(spaceTag string, useSpaceTagInName bool, name string) string {
 	return makeAnnotation("json", spaceTag, false, useSpaceTagInName, name)
 }
@@ -2,9 +2,12 @@ package chidleystein
 
 import (
 	"bufio"
-	"io"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"text/template"
 	"time"
 )
@@ -14,14 +17,98 @@ type PrintJavaJaxbVisitor struct {
 	globalTagAttributes map[string]([]*FQN)
 	nameSpaceTagMap     map[string]string
 	useType             bool
+	typePolicy          TypePolicy
+	fieldTypePolicies   map[string]TypePolicy
+	timeLayouts         []string
+	adapters            map[string]bool
+	enumLimit           int
+	provenance          bool
+	samples             SampleComments
+	catchAll            bool
+	catchAllElements    map[string]bool
+	recursion           *recursion
 	javaDir             string
 	javaPackage         string
 	namePrefix          string
+	reserved            *reservedNames
 	Date                time.Time
+	// err is the first error writing a class, after which no more are
+	// written.
+	err error
+}
+
+// WriteJava writes the schema as a Maven project of Java/JAXB classes in
+// dir: a pom.xml, a class per element in the package
+// ca.gnewton.chidley.appName.xml, and a Main in ca.gnewton.chidley.appName
+// printing sourceName as JSON. Classes are named after their element, so
+// the schema must be keyed by name.
+func (s *Schema) WriteJava(dir string, appName string, sourceName string) error {
+	if s.ex.Keying != KeyByName {
+		return fmt.Errorf("chidley: Java classes are named after their element and cannot tell elements apart by %s; use -K name", s.ex.Keying)
+	}
+	if s.ex.FirstNode == nil {
+		return errors.New("chidley: no element to write Java classes for")
+	}
+	javaPackage := javaBasePackage + "." + appName
+	javaDir := filepath.Join(dir, mavenJavaBase, strings.Replace(javaPackage, ".", "/", -1))
+	if err := os.MkdirAll(filepath.Join(javaDir, "xml"), 0755); err != nil {
+		return err
+	}
+
+	date := time.Now()
+	v := s.javaVisitor(javaDir, javaPackage, date)
+	for _, child := range s.ex.Root.Children {
+		v.Visit(child)
+	}
+	if v.err != nil {
+		return v.err
+	}
+	root := s.ex.FirstNode
+	if err := printJavaJaxbMain(root.makeJavaType(v.namePrefix, ""), javaDir, javaPackage, sourceName, date); err != nil {
+		return err
+	}
+	if err := printPackageInfo(root, javaDir, javaPackage, s.ex.GlobalTagAttributes, s.ex.NameSpaceTagMap); err != nil {
+		return err
+	}
+	return printMavenPom(filepath.Join(dir, "pom.xml"), appName)
+}
+
+// javaVisitor returns a visitor writing the Java/JAXB classes for the
+// schema to javaDir, in javaPackage, as the options ask.
+func (s *Schema) javaVisitor(javaDir string, javaPackage string, date time.Time) *PrintJavaJaxbVisitor {
+	v := &PrintJavaJaxbVisitor{
+		alreadyVisited:      make(map[string]bool),
+		globalTagAttributes: s.ex.GlobalTagAttributes,
+		nameSpaceTagMap:     s.ex.NameSpaceTagMap,
+		useType:             s.Options.UseType,
+		typePolicy:          s.Options.TypePolicy,
+		fieldTypePolicies:   s.Options.FieldTypePolicies,
+		timeLayouts:         s.Options.TimeLayouts,
+		enumLimit:           s.Options.EnumLimit,
+		provenance:          s.Options.Provenance,
+		samples:             s.Options.SampleComments,
+		catchAll:            s.Options.CatchAll,
+		catchAllElements:    s.Options.CatchAllElements,
+		recursion:           s.ex.recursion(),
+		javaDir:             javaDir,
+		javaPackage:         javaPackage,
+		namePrefix:          s.Options.NamePrefix,
+		reserved:            newReservedNames(),
+		Date:                date,
+	}
+	for _, n := range s.ex.GlobalNodeMap {
+		v.reserved.used[v.className(n)] = true
+	}
+	return v
+}
+
+// className returns the name of the class generated for n.
+func (v *PrintJavaJaxbVisitor) className(n *Node) string {
+	return v.namePrefix + cleanName(capitalizeFirstLetter(n.Name))
 }
 
 func (v *PrintJavaJaxbVisitor) Visit(node *Node) bool {
-	if v.AlreadyVisited(node) {
+	if v.err != nil || v.AlreadyVisited(node) {
 		return false
 	}
 	v.SetAlreadyVisited(node)
@@ -32,10 +119,24 @@ func (v *PrintJavaJaxbVisitor) Visit(node *Node) bool {
 	class.init()
 	class.Date = v.Date
 	class.PackageName = v.javaPackage
-	class.ClassName = v.namePrefix + cleanName(capitalizeFirstLetter(node.Name))
+	class.ClassName = v.className(node)
 	class.HasValue = node.hasCharData
-	class.ValueType = findJavaType(node.nodeTypeInfo, v.useType)
+	class.ValueType = findJavaType(node.nodeTypeInfo, v.useType, policyFor(v.typePolicy, v.fieldTypePolicies, textField(node)), v.timeLayouts)
+	class.ValueType, class.ValueList = v.list(node.nodeTypeInfo, class.ValueType, textField(node))
+	class.ValueType = v.enum(node.nodeTypeInfo, class.ValueType, class.ClassName+"Enum")
+	class.ValueType, class.ValueAdapter = v.boolAdapter(node.nodeTypeInfo, class.ValueType)
+	if class.ValueAdapter == "" {
+		class.ValueAdapter = v.adapter(class.ValueType)
+	}
 	class.Name = node.Name
+	for _, line := range node.docLines() {
+		class.Doc = append(class.Doc, strings.Replace(line, "*/", "*&#47;", -1))
+	}
+	class.ValueSamples = sampleComment(node.nodeTypeInfo, v.samples)
+	if v.provenance {
+		class.Provenance = provenance(node.Name, node.firstAt)
+		class.ValueProvenance = provenance(node.Name+" text", node.nodeTypeInfo.exampleAt)
+	}
 
 	for _, fqn := range attributes {
 		jat := new(JaxbAttribute)
@@ -48,10 +149,30 @@ func (v *PrintJavaJaxbVisitor) Visit(node *Node) bool {
 			jat.NameLower = lowerFirstLetter(cleanName)
 		}
 		jat.NameSpace = fqn.space
+		jat.Type = findJavaType(fqn.typeInfo, v.useType, policyFor(v.typePolicy, v.fieldTypePolicies, attributeField(node, fqn)), v.timeLayouts)
+		jat.Type, jat.List = v.list(fqn.typeInfo, jat.Type, attributeField(node, fqn))
+		jat.Type = v.enum(fqn.typeInfo, jat.Type, class.ClassName+jat.NameUpper+"Enum")
+		jat.Type, jat.Adapter = v.boolAdapter(fqn.typeInfo, jat.Type)
+		if jat.Adapter == "" {
+			jat.Adapter = v.adapter(jat.Type)
+		}
+		jat.Samples = sampleComment(fqn.typeInfo, v.samples)
+		if v.provenance {
+			jat.Provenance = provenance(node.Name+"@"+fqn.name, fqn.firstAt)
+		}
 		class.Attributes = append(class.Attributes, jat)
 	}
 
-	for _, child := range node.Children {
+	// Mixed content is one list of text and elements.
+	fields := node.contentChildren()
+	if node.mixed {
+		class.Mixed = true
+		class.HasValue = false
+		fields = nil
+	}
+	class.CatchAll = hasCatchAll(v.catchAll, v.catchAllElements, node)
+	class.ContentModel = ContentModelString(node.ContentModel())
+	for _, child := range fields {
 		jaf := new(JaxbField)
 		jaf.Name = child.Name
 		cleanName := cleanName(child.Name)
@@ -64,11 +185,15 @@ func (v *PrintJavaJaxbVisitor) Visit(node *Node) bool {
 		jaf.NameSpace = child.Space
 		jaf.Repeats = child.repeats
 		jaf.TypeName = child.makeJavaType(v.namePrefix, "")
+		jaf.Recursive = v.recursion.leadsBack(node, child)
+		if o, ok := node.occurs[child.localKey()]; ok && v.provenance {
+			jaf.Provenance = provenance(childPath(node, child), o.firstAt)
+		}
 		class.Fields = append(class.Fields, jaf)
 
 	}
 
-	printJaxbClass(class, v.javaDir+"/xml")
+	v.fail(printJaxbClass(class, v.javaDir+"/xml"))
 
 	for _, child := range node.Children {
 		v.Visit(child)
@@ -77,6 +202,90 @@ func (v *PrintJavaJaxbVisitor) Visit(node *Node) bool {
 	return true
 }
 
+// adapter returns the XmlAdapter JAXB needs for javaType, writing it the
+// first time, or "" if there is none.
+func (v *PrintJavaJaxbVisitor) adapter(javaType string) string {
+	if !strings.HasPrefix(javaType, javaTimePackage) {
+		return ""
+	}
+	class := strings.TrimPrefix(javaType, javaTimePackage)
+	name := class + "Adapter"
+	if v.adapters == nil {
+		v.adapters = make(map[string]bool)
+	}
+	if !v.adapters[name] {
+		v.adapters[name] = true
+		v.fail(printJaxbAdapter(&JaxbAdapterInfo{PackageName: v.javaPackage, ClassName: name, Type: class, Date: v.Date}, v.javaDir+"/xml"))
+	}
+	return name
+}
+
+// list returns the java.util.List type of a String field whose values
+// are whitespace-separated lists of numbers or booleans, for @XmlList,
+// and true, or javaType and false. Other lists stay String.
+func (v *PrintJavaJaxbVisitor) list(nti *NodeTypeInfo, javaType string, field string) (string, bool) {
+	if !v.useType || javaType != JavaString {
+		return javaType, false
+	}
+	policy := policyFor(v.typePolicy, v.fieldTypePolicies, field)
+	shape := nti.listShape(policy, v.timeLayouts, 0)
+	if shape == nil || shape.separator != " " || shape.tupleSize > 0 {
+		return javaType, false
+	}
+	item := findJavaPrimitiveType(shape.item, true, policy, v.timeLayouts)
+	// A vocabulary needs an XmlAdapter, which @XmlList does not take.
+	b := shape.item.boolVocabulary()
+	if box, ok := javaBoxes[item]; ok && (b == nil || b.typeName() != shape.itemType) {
+		item = box
+	} else if item != JavaBigInteger {
+		return javaType, false
+	}
+	return "java.util.List<" + item + ">", true
+}
+
+// boolAdapter returns Boolean and the XmlAdapter reading and writing the
+// vocabulary of a boolean field spelled in one, writing it the first
+// time, or javaType and "".
+func (v *PrintJavaJaxbVisitor) boolAdapter(nti *NodeTypeInfo, javaType string) (string, string) {
+	b := nti.boolVocabulary()
+	if b == nil || nti.alwaysBool || (javaType != JavaBoolean && javaType != javaBoxes[JavaBoolean]) {
+		return javaType, ""
+	}
+	name := b.typeName() + "Adapter"
+	if v.adapters == nil {
+		v.adapters = make(map[string]bool)
+	}
+	if !v.adapters[name] {
+		v.adapters[name] = true
+		v.fail(printJaxbBoolAdapter(&JaxbBoolAdapterInfo{PackageName: v.javaPackage, ClassName: name, True: b.True, False: b.False, Date: v.Date}, v.javaDir+"/xml"))
+	}
+	return javaBoxes[JavaBoolean], name
+}
+
+// enum returns the name of the enum class for a String field taking a
+// few values, writing it, or javaType.
+func (v *PrintJavaJaxbVisitor) enum(nti *NodeTypeInfo, javaType string, name string) string {
+	values := nti.enumValues(v.enumLimit)
+	if javaType != "String" || values == nil {
+		return javaType
+	}
+	name = v.reserved.derive(name)
+	e := &enumType{name: name, values: values}
+	info := &JaxbEnumInfo{PackageName: v.javaPackage, ClassName: name, Date: v.Date}
+	for i, constName := range e.constNames(javaEnumConstName) {
+		info.Values = append(info.Values, &JaxbEnumValue{Name: constName, Value: values[i]})
+	}
+	v.fail(printJaxbEnum(info, v.javaDir+"/xml"))
+	return name
+}
+
+// fail records err, if it is the first error.
+func (v *PrintJavaJaxbVisitor) fail(err error) {
+	if v.err == nil {
+		v.err = err
+	}
+}
+
 func (v *PrintJavaJaxbVisitor) AlreadyVisited(n *Node) bool {
 	_, ok := v.alreadyVisited[nk(n)]
 	return ok
@@ -86,25 +295,47 @@ func (v *PrintJavaJaxbVisitor) SetAlreadyVisited(n *Node) {
 	v.alreadyVisited[nk(n)] = true
 }
 
-func printJaxbClass(class *JaxbClassInfo, dir string) {
+func printJaxbClass(class *JaxbClassInfo, dir string) error {
 	t := template.Must(template.New("chidleyJaxbGen").Parse(jaxbClassTemplate))
-	//err := t.Execute(os.Stdout, jb)
-	writer, f, err := javaClassWriter(dir, class.PackageName+".xml", class.ClassName)
-	defer f.Close()
-	err = t.Execute(writer, class)
-	if err != nil {
-		log.Println("executing template:", err)
-	}
-	bufio.NewWriter(writer).Flush()
+	return writeJavaClass(dir, class.ClassName, t, class)
+}
+
+func printJaxbAdapter(adapter *JaxbAdapterInfo, dir string) error {
+	t := template.Must(template.New("chidleyJaxbAdapter").Parse(jaxbAdapterTemplate))
+	return writeJavaClass(dir, adapter.ClassName, t, adapter)
+}
+
+func printJaxbBoolAdapter(adapter *JaxbBoolAdapterInfo, dir string) error {
+	t := template.Must(template.New("chidleyJaxbBoolAdapter").Parse(jaxbBoolAdapterTemplate))
+	return writeJavaClass(dir, adapter.ClassName, t, adapter)
+}
+
+func printJaxbEnum(enum *JaxbEnumInfo, dir string) error {
+	t := template.Must(template.New("chidleyJaxbEnum").Parse(jaxbEnumTemplate))
+	return writeJavaClass(dir, enum.ClassName, t, enum)
 }
 
-func javaClassWriter(dir string, packageName string, className string) (io.Writer, *os.File, error) {
+// writeJavaClass writes the class className made by t from data to dir.
+func writeJavaClass(dir string, className string, t *template.Template, data interface{}) error {
 	fullPath := dir + "/" + className + ".java"
 	log.Print("Writing java Class file: " + fullPath)
-	fi, err := os.Create(fullPath)
+	return writeTemplate(fullPath, t, data)
+}
+
+// writeTemplate writes the text made by t from data to the file at path.
+func writeTemplate(path string, t *template.Template, data interface{}) error {
+	f, err := os.Create(path)
 	if err != nil {
-		log.Print("Problem creating file: " + fullPath)
-		panic(err)
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := t.Execute(w, data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
 	}
-	return bufio.NewWriter(fi), fi, nil
+	return f.Close()
 }
@@ -0,0 +1,103 @@
+package chidleystein
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteJava(t *testing.T) {
+	opts := DefaultOptions()
+	opts.UseType = true
+	opts.EnumLimit = 2
+	opts.BoolVocabularies = DefaultBoolVocabularies
+	s := inferString(t, `<r xmlns="urn:r"><item count="12" enabled="true" when="2006-01-02" ok="Y" kind="a">x</item><item count="3" enabled="false" when="2007-01-02" ok="N" kind="a"><n/></item><n>4</n></r>`, opts)
+
+	dir := t.TempDir()
+	if err := s.WriteJava(dir, "app", "a.xml"); err != nil {
+		t.Fatal(err)
+	}
+	javaDir := "src/main/java/ca/gnewton/chidley/app/"
+
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{"pom.xml", []string{"<artifactId>app</artifactId>"}},
+		{javaDir + "Main.java", []string{"package ca.gnewton.chidley.app;", "ChiR root = (ChiR)", `new File("a.xml")`}},
+		{javaDir + "xml/package-info.java", []string{`namespace="urn:r"`}},
+		{javaDir + "xml/ChiItem.java", []string{
+			"public short chiCount;",
+			"public boolean chiEnabled;",
+			"@XmlJavaTypeAdapter(LocalDateAdapter.class)\n    public java.time.LocalDate chiWhen;",
+			"@XmlJavaTypeAdapter(BoolYNAdapter.class)\n    public Boolean chiOk;",
+			"public ChiItemKindEnum chiKind;",
+			"public ChiN chiN;",
+		}},
+		{javaDir + "xml/ChiN.java", []string{"public Short tagValue;"}},
+		{javaDir + "xml/ChiItemKindEnum.java", []string{`@XmlEnumValue("a")`}},
+		{javaDir + "xml/LocalDateAdapter.java", []string{"LocalDate.parse"}},
+		{javaDir + "xml/BoolYNAdapter.java", []string{`"Y"`}},
+	}
+	for _, tt := range tests {
+		b, err := os.ReadFile(filepath.Join(dir, tt.file))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(string(b), want) {
+				t.Errorf("%s does not contain %q:\n%s", tt.file, want, b)
+			}
+		}
+	}
+}
+
+func TestWriteJavaKeying(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Keying = KeyByParent
+	s := inferString(t, `<r><a><name/></a><b><name/></b></r>`, opts)
+	if err := s.WriteJava(t.TempDir(), "app", "a.xml"); err == nil {
+		t.Error("WriteJava keyed by parent: no error")
+	}
+}
+
+func TestWriteJavaEnumNames(t *testing.T) {
+	opts := DefaultOptions()
+	opts.UseType = true
+	opts.EnumLimit = 5
+	s := inferString(t, `<r><Color>red</Color><Color>red</Color><ColorEnum><x>1</x></ColorEnum></r>`, opts)
+
+	dir := t.TempDir()
+	if err := s.WriteJava(dir, "app", "a.xml"); err != nil {
+		t.Fatal(err)
+	}
+	xmlDir := filepath.Join(dir, "src/main/java/ca/gnewton/chidley/app/xml")
+	for file, want := range map[string]string{
+		"ChiColor.java":       "public ChiColorEnum_2 tagValue;",
+		"ChiColorEnum.java":   "public ChiX chiX;",
+		"ChiColorEnum_2.java": "public enum ChiColorEnum_2",
+	} {
+		b, err := os.ReadFile(filepath.Join(xmlDir, file))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !strings.Contains(string(b), want) {
+			t.Errorf("%s does not contain %q:\n%s", file, want, b)
+		}
+	}
+}
+
+func TestWriteJavaError(t *testing.T) {
+	s := inferString(t, `<r><a>1</a></r>`, DefaultOptions())
+	dir := t.TempDir()
+	// A directory where a class goes cannot be written over.
+	if err := os.MkdirAll(filepath.Join(dir, "src/main/java/ca/gnewton/chidley/app/xml/ChiA.java"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteJava(dir, "app", "a.xml"); err == nil {
+		t.Error("WriteJava over a directory: no error")
+	}
+}
@@ -0,0 +1,60 @@
+package chidleystein
+
+import (
+	"strconv"
+)
+
+// Position is where a token starts in an input.
+type Position struct {
+	// File names the input; it is empty for a reader without a name.
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Offset int64  `json:"offset"`
+}
+
+func (p Position) String() string {
+	file := p.File
+	if file == "" {
+		file = "<input>"
+	}
+	return file + ":" + strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column)
+}
+
+// known reports whether p was recorded; lines count from 1.
+func (p Position) known() bool {
+	return p.Line > 0
+}
+
+// positionOrNil returns p, or nil if it is not known, for JSON.
+func positionOrNil(p Position) *Position {
+	if !p.known() {
+		return nil
+	}
+	return &p
+}
+
+// keepFirst sets p to q unless p is known: of two inputs merged, the
+// position in the first one is kept.
+func (p *Position) keepFirst(q Position) {
+	if !p.known() {
+		*p = q
+	}
+}
+
+// atPosition returns " at p" if p is known.
+func atPosition(p Position) string {
+	if !p.known() {
+		return ""
+	}
+	return " at " + p.String()
+}
+
+// provenance returns the comment saying where what was first seen, or ""
+// if that is not known.
+func provenance(what string, p Position) string {
+	if !p.known() {
+		return ""
+	}
+	return what + " first seen at " + p.String() + ", offset " + strconv.FormatInt(p.Offset, 10)
+}
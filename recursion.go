@@ -0,0 +1,154 @@
+package chidleystein
+
+import (
+	"sort"
+)
+
+// recursion holds the groups of elements leading back to themselves
+// through their children, such as nested sections, KML folders or item
+// trees. key tells the elements apart: by node key, or by struct name,
+// as a shared struct can close a loop its elements do not.
+type recursion struct {
+	key   func(*Node) string
+	group map[string]int
+}
+
+// findRecursion finds the groups among nodes: the strongly connected
+// components of the graph from the key of each node to those of its
+// children that have more than one key, or a key leading to itself.
+func findRecursion(nodes []*Node, key func(*Node) string) *recursion {
+	edges := make(map[string]map[string]bool)
+	for _, n := range nodes {
+		from := key(n)
+		if edges[from] == nil {
+			edges[from] = make(map[string]bool)
+		}
+		for _, child := range n.Children {
+			edges[from][key(child)] = true
+		}
+	}
+	keys := make([]string, 0, len(edges))
+	for k := range edges {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	r := &recursion{key: key, group: make(map[string]int)}
+	// Tarjan's algorithm.
+	index := make(map[string]int, len(keys))
+	low := make(map[string]int, len(keys))
+	onStack := make(map[string]bool, len(keys))
+	var stack []string
+	var connect func(k string)
+	connect = func(k string) {
+		index[k] = len(index)
+		low[k] = index[k]
+		stack = append(stack, k)
+		onStack[k] = true
+		for next := range edges[k] {
+			if _, ok := index[next]; !ok {
+				connect(next)
+				if low[next] < low[k] {
+					low[k] = low[next]
+				}
+			} else if onStack[next] && index[next] < low[k] {
+				low[k] = index[next]
+			}
+		}
+		if low[k] != index[k] {
+			return
+		}
+		i := len(stack) - 1
+		for stack[i] != k {
+			i--
+		}
+		component := stack[i:]
+		stack = stack[:i]
+		if len(component) > 1 || edges[k][k] {
+			for _, member := range component {
+				r.group[member] = index[k]
+			}
+		}
+		for _, member := range component {
+			onStack[member] = false
+		}
+	}
+	for _, k := range keys {
+		if _, ok := index[k]; !ok {
+			connect(k)
+		}
+	}
+	return r
+}
+
+// recursive reports whether n leads back to itself.
+func (r *recursion) recursive(n *Node) bool {
+	if r == nil {
+		return false
+	}
+	_, ok := r.group[r.key(n)]
+	return ok
+}
+
+// leadsBack reports whether child leads back to parent, so that holding
+// the child by value would make parent hold itself.
+func (r *recursion) leadsBack(parent *Node, child *Node) bool {
+	if r == nil {
+		return false
+	}
+	g, ok := r.group[r.key(parent)]
+	if !ok {
+		return false
+	}
+	h, ok := r.group[r.key(child)]
+	return ok && g == h
+}
+
+// nodes returns the root and every node of ex.
+func (ex *Extractor) nodes() []*Node {
+	nodes := make([]*Node, 0, len(ex.GlobalNodeMap)+1)
+	nodes = append(nodes, ex.Root)
+	for _, n := range ex.GlobalNodeMap {
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// recursion finds the groups of elements of ex leading back to
+// themselves.
+func (ex *Extractor) recursion() *recursion {
+	return findRecursion(ex.nodes(), nk)
+}
+
+// recursiveWith returns the names of the elements of ex in the group of
+// n, n included, sorted, or nil if n does not lead back to itself.
+func (ex *Extractor) recursiveWith(r *recursion, n *Node) []string {
+	if !r.recursive(n) {
+		return nil
+	}
+	var names []string
+	for _, m := range ex.GlobalNodeMap {
+		if r.leadsBack(n, m) && !containsString(names, m.Name) {
+			names = append(names, m.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// nestedTypes returns the sorted names of the structs leading back to
+// themselves, which the converter reads and writes without recursion.
+// Those holding mixed content as raw XML hold no children, and are left
+// out.
+func (s *Schema) nestedTypes(namer *typeNamer) []string {
+	r := findRecursion(s.ex.nodes(), namer.typeName)
+	var names []string
+	for _, n := range s.ex.GlobalNodeMap {
+		name := namer.typeName(n)
+		if r.recursive(n) && !(n.mixed && s.Options.mixedFor(n) == MixedInnerXML) && !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
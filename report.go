@@ -0,0 +1,81 @@
+package chidleystein
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// reportTypes are the types listed by WriteTypeReport, in order.
+var reportTypes = []string{
+	GoBool,
+	kindDateTime.name, kindLocalDateTime.name, kindDate.name, kindDateZone.name, kindTime.name, kindTimeZone.name, kindDuration.name,
+	GoInt8, GoInt16, GoInt32, GoInt64, GoInt,
+	GoUint8, GoUint16, GoUint32, GoUint64,
+	GoFloat32, GoFloat64,
+}
+
+// WriteTypeReport writes, for the text of every element and for every
+// attribute, the type of its field with UseType, such as NullInt8 or an
+// enumeration, the first value seen, and the value that ruled out each
+// other type.
+func (s *Schema) WriteTypeReport(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	v := s.goStructVisitor(nil)
+	v.useType = true
+	v.namer = s.typeNamer()
+	for _, n := range s.ex.nodesByDiscoveredOrder() {
+		path := strings.Join(append(append([]string{}, n.context...), n.Name), "/")
+		if n.hasCharData {
+			t := v.fieldType(n.nodeTypeInfo, textField(n), v.typeName(n))
+			s.reportField(bw, path, t, n.nodeTypeInfo)
+		}
+		attributes := append([]*FQN{}, s.ex.GlobalTagAttributes[nk(n)]...)
+		sort.Sort(fqnSorter(attributes))
+		for _, fqn := range attributes {
+			t := v.fieldType(fqn.typeInfo, attributeField(n, fqn), v.typeName(n)+"_"+identifier(fqn.name))
+			s.reportField(bw, path+"@"+fqn.name, t, fqn.typeInfo)
+		}
+	}
+	return bw.Flush()
+}
+
+// typeNames returns the names of the types checked, as keys of
+// NodeTypeInfo.blocked, in the order they are reported: custom layouts,
+// then bool and the vocabularies, then the others of reportTypes.
+func (s *Schema) typeNames() []string {
+	var types []string
+	for _, layout := range s.Options.TimeLayouts {
+		types = append(types, layoutBlockKey(layout))
+	}
+	types = append(types, GoBool)
+	for _, b := range s.Options.BoolVocabularies {
+		types = append(types, boolVocabularyBlockKey(b))
+	}
+	return append(types, reportTypes[1:]...)
+}
+
+func (s *Schema) reportField(w *bufio.Writer, path string, t string, nti *NodeTypeInfo) {
+	w.WriteString(path + ": " + t)
+	if nti.example != "" {
+		w.WriteString(", e.g. " + strconv.Quote(nti.example))
+	}
+	w.WriteString("\n")
+
+	// Group the types ruled out by the same value.
+	var values []string
+	byValue := make(map[string][]string)
+	for _, typeName := range s.typeNames() {
+		if v, ok := nti.blocked[typeName]; ok {
+			if _, seen := byValue[v]; !seen {
+				values = append(values, v)
+			}
+			byValue[v] = append(byValue[v], typeName)
+		}
+	}
+	for _, v := range values {
+		w.WriteString("\tnot " + strings.Join(byValue[v], ", ") + ": " + strconv.Quote(v) + "\n")
+	}
+}
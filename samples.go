@@ -0,0 +1,159 @@
+package chidleystein
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SampleComments selects whether generated fields get a comment with
+// sample values.
+type SampleComments int
+
+const (
+	// SamplesOff writes no sample comments.
+	SamplesOff SampleComments = iota
+	// SamplesShown writes the sample values, quoted.
+	SamplesShown
+	// SamplesRedacted writes the shape of the sample values only: each
+	// letter is x or X and each digit 9, so "AB-12" becomes "XX-99".
+	SamplesRedacted
+)
+
+var sampleCommentsNames = []string{"off", "show", "redact"}
+
+func (c SampleComments) String() string {
+	if c < 0 || int(c) >= len(sampleCommentsNames) {
+		return "SampleComments(" + strconv.Itoa(int(c)) + ")"
+	}
+	return sampleCommentsNames[c]
+}
+
+// ParseSampleComments returns the SampleComments named s: off, show or
+// redact.
+func ParseSampleComments(s string) (SampleComments, error) {
+	for i, name := range sampleCommentsNames {
+		if s == name {
+			return SampleComments(i), nil
+		}
+	}
+	return SamplesOff, fmt.Errorf("chidley: unknown sample comments %q (want off, show or redact)", s)
+}
+
+// maxSamples bounds NodeTypeInfo.samples.
+const maxSamples = 5
+
+// maxSampleLength bounds, in runes, a sample value in a comment.
+const maxSampleLength = 32
+
+// addSample feeds v, the count-th value seen, to the reservoir of
+// samples: each value seen has the same chance to be kept, so values
+// seen often are more likely to be, but a value is kept only once.
+//
+// The draws are a function of count, so that the same input always gives
+// the same samples.
+func (n *NodeTypeInfo) addSample(v string) {
+	if len(n.samples) < maxSamples {
+		n.addSampleOnce(v)
+		return
+	}
+	if j := mix(uint64(n.count)) % uint64(n.count); j < maxSamples {
+		n.replaceSample(int(j), v)
+	}
+}
+
+// mergeSamples folds the samples of o into those of n, before their
+// counts are added up: a sample of o takes a slot with the chance that a
+// value of both comes from o.
+func (n *NodeTypeInfo) mergeSamples(o *NodeTypeInfo) {
+	total := uint64(n.count + o.count)
+	for i, v := range o.samples {
+		if len(n.samples) < maxSamples {
+			n.addSampleOnce(v)
+			continue
+		}
+		if r := mix(total+uint64(i)) % total; r < uint64(o.count) {
+			n.replaceSample(int(r%maxSamples), v)
+		}
+	}
+}
+
+// addSampleOnce appends v unless it is a sample already.
+func (n *NodeTypeInfo) addSampleOnce(v string) {
+	for _, s := range n.samples {
+		if s == v {
+			return
+		}
+	}
+	n.samples = append(n.samples, v)
+}
+
+// replaceSample puts v in slot i unless it is a sample already.
+func (n *NodeTypeInfo) replaceSample(i int, v string) {
+	for _, s := range n.samples {
+		if s == v {
+			return
+		}
+	}
+	n.samples[i] = v
+}
+
+// mix is the SplitMix64 finalizer, a cheap and well spread hash.
+func mix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// sampleComment returns the comment listing the samples of nti, sorted,
+// truncated and quoted, or "" if c is SamplesOff or there are none.
+func sampleComment(nti *NodeTypeInfo, c SampleComments) string {
+	if c == SamplesOff || len(nti.samples) == 0 {
+		return ""
+	}
+	samples := make([]string, len(nti.samples))
+	for i, v := range nti.samples {
+		if c == SamplesRedacted {
+			v = redact(v)
+		}
+		samples[i] = v
+	}
+	sort.Strings(samples)
+	quoted := make([]string, 0, len(samples))
+	for _, v := range samples {
+		// Redacting and truncating may make two samples the same.
+		if q := quoteSample(v); len(quoted) == 0 || q != quoted[len(quoted)-1] {
+			quoted = append(quoted, q)
+		}
+	}
+	return "e.g. " + strings.Join(quoted, ", ")
+}
+
+// quoteSample quotes v, cut after maxSampleLength runes and followed by
+// ... if longer.
+func quoteSample(v string) string {
+	if utf8.RuneCountInString(v) <= maxSampleLength {
+		return strconv.Quote(v)
+	}
+	return strconv.Quote(string([]rune(v)[:maxSampleLength])) + "..."
+}
+
+// redact returns the shape of v: x for a lower case letter, X for
+// another letter, 9 for a digit; other characters stay.
+func redact(v string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLower(r):
+			return 'x'
+		case unicode.IsLetter(r):
+			return 'X'
+		case unicode.IsDigit(r):
+			return '9'
+		}
+		return r
+	}, v)
+}
@@ -3,9 +3,9 @@ package chidleystein
 import (
 	"bufio"
 	"io"
-	"log"
 	"net/http"
 	"os"
+	"strconv"
 )
 
 type Source interface {
@@ -16,6 +16,22 @@ type Source interface {
 	copySource() (Source, error)
 }
 
+// NewSource opens sourceName as a URL, as standard input or as a
+// (possibly compressed) file.
+func NewSource(sourceName string, url bool, standardIn bool) (Source, error) {
+	var source Source
+	switch {
+	case url:
+		source = new(UrlSource)
+	case standardIn:
+		source = new(StdinSource)
+	default:
+		source = new(FileSource)
+	}
+	err := source.NewSource(sourceName)
+	return source, err
+}
+
 type GenericSource struct {
 	name   string
 	reader io.Reader
@@ -75,17 +91,18 @@ func (us *UrlSource) NewSource(name string) error {
 
 	res, err := http.Get(name)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	if res.StatusCode != 200 {
-		log.Fatal("ERROR: bad http status code != 200: ", res.StatusCode, "   ", name)
-		return nil
-
+		res.Body.Close()
+		err := new(InternalError)
+		err.ErrorString = "bad http status code != 200: " + strconv.Itoa(res.StatusCode) + "   " + name
+		return err
 	}
 	us.reader = res.Body
 
-	return err
+	return nil
 }
 
 func (us UrlSource) Close() error {
@@ -5,13 +5,12 @@ import (
 )
 
 type StdoutWriter struct {
+	doneChannel chan bool
 }
 
-var doneChannel chan bool
-
 func (w *StdoutWriter) Open(s string, lineChannel chan string) error {
-	doneChannel = make(chan bool)
-	go w.Writer(lineChannel, doneChannel)
+	w.doneChannel = make(chan bool)
+	go w.Writer(lineChannel, w.doneChannel)
 
 	return nil
 }
@@ -24,5 +23,5 @@ func (w *StdoutWriter) Writer(lineChannel chan string, doneChannel chan bool) {
 }
 
 func (w *StdoutWriter) Close() {
-	_ = <-doneChannel
+	_ = <-w.doneChannel
 }
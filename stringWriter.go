@@ -5,12 +5,13 @@ var (
 )
 
 type StringWriter struct {
-	S string
+	S           string
+	doneChannel chan bool
 }
 
 func (w *StringWriter) Open(s string, lineChannel chan string) error {
-	doneChannel = make(chan bool)
-	go w.Writer(lineChannel, doneChannel)
+	w.doneChannel = make(chan bool)
+	go w.Writer(lineChannel, w.doneChannel)
 	return nil
 }
 
@@ -22,5 +23,5 @@ func (w *StringWriter) Writer(lineChannel chan string, doneChannel chan bool) {
 }
 
 func (w *StringWriter) Close() {
-	_ = <-doneChannel
+	_ = <-w.doneChannel
 }
@@ -0,0 +1,238 @@
+package chidleystein
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeKind is a lexical form of dates, times or durations, and the type
+// generated for the fields whose values all have it.
+type timeKind struct {
+	// name is the Go type of the fields. Except for time.Time, it is a
+	// type generated next to the structs, converting to and from layout.
+	name   string
+	layout string
+	// javaType is a java.time class, or empty for String.
+	javaType string
+}
+
+var (
+	kindDateTime      = &timeKind{name: GoTime, layout: "2006-01-02T15:04:05.999999999Z07:00", javaType: "OffsetDateTime"}
+	kindLocalDateTime = &timeKind{name: "XsDateTime", layout: "2006-01-02T15:04:05.999999999", javaType: "LocalDateTime"}
+	kindDate          = &timeKind{name: "XsDate", layout: "2006-01-02", javaType: "LocalDate"}
+	kindDateZone      = &timeKind{name: "XsDateZone", layout: "2006-01-02Z07:00"}
+	kindTime          = &timeKind{name: "XsTime", layout: "15:04:05.999999999", javaType: "LocalTime"}
+	kindTimeZone      = &timeKind{name: "XsTimeZone", layout: "15:04:05.999999999Z07:00", javaType: "OffsetTime"}
+	kindDuration      = &timeKind{name: "XsDuration", javaType: "Duration"}
+)
+
+// layoutTypeName names the type generated for the i-th (from 0) custom
+// layout of Options.TimeLayouts.
+func layoutTypeName(i int) string {
+	return "Layout" + strconv.Itoa(i+1)
+}
+
+// timeTypeNames returns the names of all the types that may be generated
+// for dates, times and durations, so that no struct takes them.
+func timeTypeNames(layouts []string) []string {
+	names := []string{kindLocalDateTime.name, kindDate.name, kindDateZone.name, kindTime.name, kindTimeZone.name, kindDuration.name}
+	for i := range layouts {
+		names = append(names, layoutTypeName(i))
+	}
+	return names
+}
+
+// timeKind returns the kind all the values seen by nti have, trying the
+// custom layouts before the XML Schema ones, or nil.
+func (nti *NodeTypeInfo) timeKind(layouts []string) *timeKind {
+	for i, layout := range layouts {
+		if nti.alwaysLayout(layout) {
+			return &timeKind{name: layoutTypeName(i), layout: layout}
+		}
+	}
+	switch {
+	case nti.alwaysDateTime:
+		return kindDateTime
+	case nti.alwaysLocalDateTime:
+		return kindLocalDateTime
+	case nti.alwaysDate:
+		return kindDate
+	case nti.alwaysDateZone:
+		return kindDateZone
+	case nti.alwaysTime:
+		return kindTime
+	case nti.alwaysTimeZone:
+		return kindTimeZone
+	case nti.alwaysDuration:
+		return kindDuration
+	}
+	return nil
+}
+
+// xsDurationPattern matches the xs:duration values that fit a
+// time.Duration: days, hours, minutes and seconds, but no years or
+// months.
+const xsDurationPattern = `^(-)?P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`
+
+var xsDurationRegexp = regexp.MustCompile(xsDurationPattern)
+
+var errNotDuration = errors.New("chidley: not an xs:duration of days, hours, minutes and seconds")
+
+func parseXsDuration(s string) (time.Duration, error) {
+	m := xsDurationRegexp.FindStringSubmatch(s)
+	if m == nil || strings.HasSuffix(s, "P") || strings.HasSuffix(s, "T") {
+		return 0, errNotDuration
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute} {
+		if m[i+2] != "" {
+			n, err := strconv.ParseInt(m[i+2], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			d += time.Duration(n) * unit
+		}
+	}
+	if m[5] != "" {
+		seconds, err := strconv.ParseFloat(m[5], 64)
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(seconds * float64(time.Second))
+	}
+	if m[1] != "" {
+		d = -d
+	}
+	return d, nil
+}
+
+// generatedTypeImports returns the packages used by the fields and the
+// generated date, time, duration, nullable and list types, besides
+// encoding/json, fmt and strings.
+func generatedTypeImports(timeKinds map[string]*timeKind, nullKinds map[string]*nullKind, listItems map[string]*listItem, usesTime bool) []string {
+	var imports []string
+	_, duration := timeKinds[kindDuration.name]
+	if duration {
+		imports = append(imports, "regexp")
+	}
+	parses := false
+	for _, k := range nullKinds {
+		parses = parses || k.parse != ""
+	}
+	for _, item := range listItems {
+		parses = parses || (item.enum == nil && nullKindOf(item.goType).parse != "")
+	}
+	if duration || parses {
+		imports = append(imports, "strconv")
+	}
+	if len(timeKinds) > 0 || usesTime {
+		imports = append(imports, "time")
+	}
+	return imports
+}
+
+// printTimeTypes writes the types generated for kinds.
+func printTimeTypes(lineChannel chan string, kinds map[string]*timeKind) {
+	var names []string
+	for name := range kinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lineChannel <- timeTypeSource(kinds[name])
+	}
+}
+
+func timeTypeSource(k *timeKind) string {
+	if k == kindDuration {
+		return strings.Replace(xsDurationSource, "XSDURATIONPATTERN", "`"+xsDurationPattern+"`", 1)
+	}
+	layout := strconv.Quote(k.layout)
+	return strings.NewReplacer("NAME", k.name, "LAYOUT", layout).Replace(layoutSource)
+}
+
+const layoutSource = `// NAME is a time read and written in the layout LAYOUT.
+type NAME time.Time
+
+func (t NAME) MarshalText() ([]byte, error) {
+	return []byte(time.Time(t).Format(LAYOUT)), nil
+}
+
+func (t *NAME) UnmarshalText(b []byte) error {
+	v, err := time.Parse(LAYOUT, strings.TrimSpace(string(b)))
+	if err != nil {
+		return err
+	}
+	*t = NAME(v)
+	return nil
+}
+`
+
+const xsDurationSource = `// XsDuration is an xs:duration of days, hours, minutes and seconds. It
+// is written with the largest units first, e.g. P1DT2H30M.
+type XsDuration time.Duration
+
+var xsDurationRegexp = regexp.MustCompile(XSDURATIONPATTERN)
+
+func (d XsDuration) MarshalText() ([]byte, error) {
+	v := time.Duration(d)
+	s := "P"
+	if v < 0 {
+		s, v = "-P", -v
+	}
+	if days := v / (24 * time.Hour); days > 0 {
+		s += strconv.FormatInt(int64(days), 10) + "D"
+		v -= days * 24 * time.Hour
+	}
+	if v == 0 && s[len(s)-1] != 'P' {
+		return []byte(s), nil
+	}
+	s += "T"
+	if hours := v / time.Hour; hours > 0 {
+		s += strconv.FormatInt(int64(hours), 10) + "H"
+		v -= hours * time.Hour
+	}
+	if minutes := v / time.Minute; minutes > 0 {
+		s += strconv.FormatInt(int64(minutes), 10) + "M"
+		v -= minutes * time.Minute
+	}
+	if v > 0 || s[len(s)-1] == 'T' {
+		s += strconv.FormatFloat(v.Seconds(), 'f', -1, 64) + "S"
+	}
+	return []byte(s), nil
+}
+
+func (d *XsDuration) UnmarshalText(b []byte) error {
+	s := strings.TrimSpace(string(b))
+	m := xsDurationRegexp.FindStringSubmatch(s)
+	if m == nil || strings.HasSuffix(s, "P") || strings.HasSuffix(s, "T") {
+		return fmt.Errorf("invalid xs:duration %q", s)
+	}
+	var v time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute} {
+		if m[i+2] != "" {
+			n, err := strconv.ParseInt(m[i+2], 10, 64)
+			if err != nil {
+				return err
+			}
+			v += time.Duration(n) * unit
+		}
+	}
+	if m[5] != "" {
+		seconds, err := strconv.ParseFloat(m[5], 64)
+		if err != nil {
+			return err
+		}
+		v += time.Duration(seconds * float64(time.Second))
+	}
+	if m[1] != "" {
+		v = -v
+	}
+	*d = XsDuration(v)
+	return nil
+}
+`
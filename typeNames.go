@@ -0,0 +1,353 @@
+package chidleystein
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// typeNamer decides the Go type of every node. With KeyByParent or
+// KeyByPath one element name can have several nodes: those whose structs
+// come out identical share one type named after the element, the others
+// get names qualified by as many ancestor names as needed to tell them
+// apart. With Options.ShareTypes, nodes of different names whose structs
+// are identical also share one type, named by Options.SharedTypeNaming.
+type typeNamer struct {
+	opts                Options
+	globalTagAttributes map[string][]*FQN
+	signatures          map[*Node]string
+	inProgress          map[*Node]bool
+	names               map[*Node]string
+	canonical           map[*Node]*Node
+	shared              map[*Node]bool
+	reserved            *reservedNames
+}
+
+// reservedNames are the type names taken in one generated file. Types
+// derived from another's name, like enumerations, take a free one.
+type reservedNames struct {
+	used    map[string]bool
+	derived map[string]string
+}
+
+func newReservedNames() *reservedNames {
+	return &reservedNames{used: make(map[string]bool), derived: make(map[string]string)}
+}
+
+// derive returns the type name to use for name, a type derived from
+// another's: name itself, or name_2, name_3 ... if taken. Deriving the
+// same name again returns the same type name.
+func (r *reservedNames) derive(name string) string {
+	if unique, ok := r.derived[name]; ok {
+		return unique
+	}
+	unique := name
+	for i := 2; r.used[unique]; i++ {
+		unique = name + "_" + strconv.Itoa(i)
+	}
+	r.used[unique] = true
+	r.derived[name] = unique
+	return unique
+}
+
+// typeCluster is a set of nodes generating one type.
+type typeCluster struct {
+	nodes []*Node
+	// localKeys are the distinct element names in nodes, in order.
+	localKeys []string
+}
+
+// newTypeNamer names the types of nodes. The nodes in unshareable never
+// share a type with nodes of another name.
+func newTypeNamer(nodes []*Node, globalTagAttributes map[string][]*FQN, opts Options, unshareable ...*Node) *typeNamer {
+	t := &typeNamer{
+		opts:                opts,
+		globalTagAttributes: globalTagAttributes,
+		signatures:          make(map[*Node]string),
+		inProgress:          make(map[*Node]bool),
+		names:               make(map[*Node]string),
+		canonical:           make(map[*Node]*Node),
+		shared:              make(map[*Node]bool),
+		reserved:            newReservedNames(),
+	}
+	keepApart := make(map[*Node]bool)
+	for _, n := range unshareable {
+		keepApart[n] = true
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].DiscoveredOrder != nodes[j].DiscoveredOrder {
+			return nodes[i].DiscoveredOrder < nodes[j].DiscoveredOrder
+		}
+		return nk(nodes[i]) < nk(nodes[j])
+	})
+
+	var clusters []*typeCluster
+	byKey := make(map[string]*typeCluster)
+	clustersByName := make(map[string][]*typeCluster)
+	for _, n := range nodes {
+		localKey := n.localKey()
+		clusterKey := localKey + "\n" + t.signature(n)
+		if opts.ShareTypes && !keepApart[n] && t.isShareable(n) {
+			clusterKey = "shared\n" + t.signature(n)
+		}
+		c, ok := byKey[clusterKey]
+		if !ok {
+			c = new(typeCluster)
+			byKey[clusterKey] = c
+			clusters = append(clusters, c)
+		}
+		if !containsString(c.localKeys, localKey) {
+			c.localKeys = append(c.localKeys, localKey)
+			clustersByName[localKey] = append(clustersByName[localKey], c)
+		}
+		c.nodes = append(c.nodes, n)
+	}
+
+	used := t.reserved.used
+	if opts.UseType {
+		for _, name := range timeTypeNames(opts.TimeLayouts) {
+			used[name] = true
+		}
+		for _, name := range nullTypeNames(opts.TimeLayouts) {
+			used[name] = true
+		}
+		for _, name := range boolTypeNames(opts.BoolVocabularies) {
+			used[name] = true
+		}
+		for _, name := range listTypeNames(opts.TimeLayouts, opts.BoolVocabularies) {
+			used[name] = true
+		}
+	}
+	if opts.CatchAll || len(opts.CatchAllElements) > 0 {
+		used[anyElementType] = true
+	}
+	numShared := 0
+	for _, c := range clusters {
+		rep := c.nodes[0]
+		var name string
+		switch {
+		case len(c.localKeys) > 1:
+			numShared += 1
+			name = t.sharedName(c, numShared)
+		case len(clustersByName[c.localKeys[0]]) > 1:
+			var distinct []*Node
+			for _, o := range clustersByName[c.localKeys[0]] {
+				distinct = append(distinct, o.first(c.localKeys[0]))
+			}
+			name = t.qualifiedName(rep, distinct)
+		default:
+			name = rep.MakeType(opts.NamePrefix, opts.NameSuffix)
+		}
+		base := strings.TrimSuffix(name, opts.NameSuffix)
+		for i := 2; used[name]; i++ {
+			name = base + "_" + strconv.Itoa(i) + opts.NameSuffix
+		}
+		used[name] = true
+
+		for _, n := range c.nodes {
+			t.names[n] = name
+			t.canonical[n] = rep
+			t.shared[n] = len(c.localKeys) > 1
+		}
+	}
+	return t
+}
+
+// first returns the first node of c named by localKey.
+func (c *typeCluster) first(localKey string) *Node {
+	for _, n := range c.nodes {
+		if n.localKey() == localKey {
+			return n
+		}
+	}
+	return nil
+}
+
+// isShareable reports whether n may share its type with elements of
+// other names. Text-only elements all look alike and are left alone.
+func (t *typeNamer) isShareable(n *Node) bool {
+	return len(n.Children) > 0 || len(t.globalTagAttributes[nk(n)]) > 0
+}
+
+// sharedName names the type shared by the elements of c, the i-th shared
+// type.
+func (t *typeNamer) sharedName(c *typeCluster, i int) string {
+	var names []string
+	for _, localKey := range c.localKeys {
+		names = append(names, c.first(localKey).Name)
+	}
+	rep := c.nodes[0]
+
+	var name string
+	switch {
+	case t.opts.SharedTypeName != nil:
+		name = t.opts.SharedTypeName(names)
+	case t.opts.SharedTypeNaming == SharedNameCommon:
+		name = commonName(names)
+	case t.opts.SharedTypeNaming == SharedNameNumbered:
+		name = "Shared" + strconv.Itoa(i)
+	}
+	if name == "" {
+		return rep.MakeType(t.opts.NamePrefix, t.opts.NameSuffix)
+	}
+	return capitalizeFirstLetter(makeTypeGeneric(name, rep.spaceTag, t.opts.NamePrefix, t.opts.NameSuffix, false))
+}
+
+// commonName returns the longest substring found in all names, trimmed
+// of separators, e.g. Date for DateCreated and PubDate. It returns "" if
+// there is none of at least three characters.
+func commonName(names []string) string {
+	first := names[0]
+	for length := len(first); length >= 3; length-- {
+		for start := 0; start+length <= len(first); start++ {
+			candidate := first[start : start+length]
+			common := true
+			for _, name := range names[1:] {
+				if !strings.Contains(name, candidate) {
+					common = false
+					break
+				}
+			}
+			if common {
+				if trimmed := strings.Trim(candidate, "-_."); len(trimmed) >= 3 {
+					return trimmed
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func containsString(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// typeName returns the name of the Go type generated for n.
+func (t *typeNamer) typeName(n *Node) string {
+	if name, ok := t.names[n]; ok {
+		return name
+	}
+	return n.MakeType(t.opts.NamePrefix, t.opts.NameSuffix)
+}
+
+// isShared reports whether n shares its type with elements of other
+// names; such types carry no element name of their own.
+func (t *typeNamer) isShared(n *Node) bool {
+	return t.shared[n]
+}
+
+// isCanonical reports whether the struct for n must be printed, that is
+// whether n is the first of the nodes sharing its type.
+func (t *typeNamer) isCanonical(n *Node) bool {
+	rep, ok := t.canonical[n]
+	return !ok || rep == n
+}
+
+// qualifiedName prefixes the name of n with the fewest ancestor names
+// that make it unique among distinct.
+func (t *typeNamer) qualifiedName(n *Node, distinct []*Node) string {
+	for depth := 1; depth <= len(n.context); depth++ {
+		unique := true
+		name := qualify(n, depth)
+		for _, o := range distinct {
+			if o != n && qualify(o, depth) == name {
+				unique = false
+				break
+			}
+		}
+		if unique {
+			return capitalizeFirstLetter(makeTypeGeneric(name, n.spaceTag, t.opts.NamePrefix, t.opts.NameSuffix, false))
+		}
+	}
+	return capitalizeFirstLetter(makeTypeGeneric(qualify(n, len(n.context)), n.spaceTag, t.opts.NamePrefix, t.opts.NameSuffix, false))
+}
+
+func qualify(n *Node, depth int) string {
+	if depth > len(n.context) {
+		depth = len(n.context)
+	}
+	parts := append([]string{}, n.context[len(n.context)-depth:]...)
+	return strings.Join(append(parts, n.Name), "_")
+}
+
+// signature summarizes everything that shows in the body of the struct
+// generated for n: its attributes, text type and children with their own
+// signatures. The element's own name is left out so that elements of
+// different names can share a type.
+func (t *typeNamer) signature(n *Node) string {
+	if signature, ok := t.signatures[n]; ok {
+		return signature
+	}
+	if t.inProgress[n] {
+		// Recursive structure: refer to the node by name.
+		return "cycle " + nk(n)
+	}
+	t.inProgress[n] = true
+
+	var b strings.Builder
+	var attributes []string
+	for _, fqn := range t.globalTagAttributes[nk(n)] {
+		attribute := fqn.space + " " + fqn.name + " " + t.fieldSignature(fqn.typeInfo, attributeField(n, fqn))
+		if minOccurs, _ := n.AttributeOccurs(fqn); minOccurs == 0 {
+			attribute += " optional"
+		}
+		attributes = append(attributes, attribute)
+	}
+	sort.Strings(attributes)
+	for _, attribute := range attributes {
+		b.WriteString("attr " + attribute + "\n")
+	}
+
+	if t.opts.hasCatchAll(n) {
+		b.WriteString("catch-all\n")
+	}
+	if n.mixed {
+		b.WriteString("mixed " + t.opts.mixedFor(n).String() + "\n")
+	}
+	if n.hasCharData {
+		b.WriteString("text " + t.fieldSignature(n.nodeTypeInfo, textField(n)) + "\n")
+	}
+
+	if model := ContentModelString(n.ContentModel()); model != "" {
+		b.WriteString("content " + model + "\n")
+	}
+	for _, child := range n.contentChildren() {
+		b.WriteString("child " + child.localKey())
+		if t.opts.UseOccurs {
+			minOccurs, maxOccurs := n.ChildOccurs(child)
+			b.WriteString(" " + strconv.Itoa(minOccurs) + ".." + strconv.Itoa(maxOccurs))
+		} else if child.repeats {
+			b.WriteString(" repeats")
+		}
+		b.WriteString(" " + t.signature(child) + "\n")
+	}
+
+	sum := sha1.Sum([]byte(b.String()))
+	signature := hex.EncodeToString(sum[:])
+	delete(t.inProgress, n)
+	t.signatures[n] = signature
+	return signature
+}
+
+// fieldSignature summarizes the type of a text or attribute field.
+func (t *typeNamer) fieldSignature(nti *NodeTypeInfo, field string) string {
+	policy := t.opts.policyFor(field)
+	goType := fieldGoType(nti, t.opts.UseType, policy, t.opts.TimeLayouts)
+	if values := nti.enumValues(t.opts.EnumLimit); goType == "string" && values != nil {
+		return "enum " + strconv.Quote(strings.Join(values, "\n"))
+	}
+	if goType == "string" && t.opts.UseType {
+		if shape := nti.listShape(policy, t.opts.TimeLayouts, t.opts.EnumLimit); shape != nil {
+			return shape.signature(tupleFieldNames(t.opts.TupleFields, field, shape.tupleSize))
+		}
+	}
+	return goType
+}
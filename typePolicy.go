@@ -0,0 +1,65 @@
+package chidleystein
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// TypePolicy selects the Go type of a field from the types all its
+// values parsed as, when Options.UseType is set.
+type TypePolicy int
+
+const (
+	// TypeSmallestSigned picks the smallest signed integer or float type.
+	TypeSmallestSigned TypePolicy = iota
+	// TypeSmallest picks the smallest integer type, preferring unsigned
+	// types when no value was negative, so that IDs and counters above
+	// the signed range become uint32 or uint64 instead of a float.
+	TypeSmallest
+	// TypeCanonical uses int64 and float64 only, and uint64 for integers
+	// beyond the range of int64.
+	TypeCanonical
+)
+
+var typePolicyNames = []string{"signed", "smallest", "canonical"}
+
+func (p TypePolicy) String() string {
+	if p < 0 || int(p) >= len(typePolicyNames) {
+		return "TypePolicy(" + strconv.Itoa(int(p)) + ")"
+	}
+	return typePolicyNames[p]
+}
+
+// ParseTypePolicy returns the TypePolicy named s: signed, smallest or
+// canonical.
+func ParseTypePolicy(s string) (TypePolicy, error) {
+	for i, name := range typePolicyNames {
+		if s == name {
+			return TypePolicy(i), nil
+		}
+	}
+	return TypeSmallestSigned, fmt.Errorf("chidley: unknown type policy %q (want signed, smallest or canonical)", s)
+}
+
+// textField and attributeField name the fields that
+// Options.FieldTypePolicies refers to: the text of an element is named
+// after the element, an attribute is element@attribute.
+func textField(n *Node) string {
+	return n.Name
+}
+
+func attributeField(n *Node, fqn *FQN) string {
+	return n.Name + "@" + fqn.name
+}
+
+// policyFor returns the policy in fields for field, or def.
+func policyFor(def TypePolicy, fields map[string]TypePolicy, field string) TypePolicy {
+	if p, ok := fields[field]; ok {
+		return p
+	}
+	return def
+}
+
+func (o Options) policyFor(field string) TypePolicy {
+	return policyFor(o.TypePolicy, o.FieldTypePolicies, field)
+}
@@ -5,9 +5,7 @@ import (
 	"compress/bzip2"
 	"compress/gzip"
 	"io"
-	"log"
 	"os"
-	"sort"
 	"strings"
 )
 
@@ -37,8 +35,13 @@ func cleanName(name string) string {
 	return name
 }
 
-func findType(nti *NodeTypeInfo, useType bool) string {
-	if !useType {
+func findType(nti *NodeTypeInfo, useType bool, policy TypePolicy, layouts []string) string {
+	if !useType || nti.padded {
+		return "string"
+	}
+
+	// Only empty or nil values: no evidence for anything else.
+	if nti.example == "" && nti.absent > 0 {
 		return "string"
 	}
 
@@ -46,6 +49,49 @@ func findType(nti *NodeTypeInfo, useType bool) string {
 		return "bool"
 	}
 
+	if b := nti.boolVocabulary(); b != nil {
+		return b.typeName()
+	}
+
+	if k := nti.timeKind(layouts); k != nil {
+		return k.name
+	}
+
+	switch policy {
+	case TypeCanonical:
+		switch {
+		case nti.alwaysInt64:
+			return GoInt64
+		case nti.alwaysUint64:
+			return GoUint64
+		case nti.alwaysFloat64:
+			return GoFloat64
+		}
+		return "string"
+
+	case TypeSmallest:
+		// Widest to narrowest would pick int64 for every counter; an
+		// unsigned type wins over the signed one of the same width.
+		switch {
+		case nti.alwaysUint08:
+			return GoUint8
+		case nti.alwaysInt08:
+			return GoInt8
+		case nti.alwaysUint16:
+			return GoUint16
+		case nti.alwaysInt16:
+			return GoInt16
+		case nti.alwaysUint32:
+			return GoUint32
+		case nti.alwaysInt32:
+			return GoInt32
+		case nti.alwaysUint64:
+			return GoUint64
+		case nti.alwaysInt64:
+			return GoInt64
+		}
+	}
+
 	if nti.alwaysInt08 {
 		return "int8"
 	}
@@ -72,24 +118,18 @@ func findType(nti *NodeTypeInfo, useType bool) string {
 	return "string"
 }
 
-type fqnSorter []*FQN
-
-func makeAttributes(lineChannel chan string, prefix string, attributes []*FQN, nameSpaceTagMap map[string]string) {
-	sort.Sort(fqnSorter(attributes))
-
-	for _, fqn := range attributes {
-		name := fqn.name
-		space := fqn.space
-
-		spaceTag, ok := nameSpaceTagMap[space]
-		if ok && spaceTag != "" {
-			spaceTag = spaceTag + "_"
-		}
-
-		lineChannel <- "\t" + prefix + spaceTag + cleanName(name) + " string `xml:\"" + space + " " + name + ",attr\"  json:\",omitempty\"`"
+// fieldGoType returns the type of a field with the values seen by nti:
+// the one chosen by findType, nullable if some values were missing.
+func fieldGoType(nti *NodeTypeInfo, useType bool, policy TypePolicy, layouts []string) string {
+	t := findType(nti, useType, policy, layouts)
+	if t != "string" && nti.isNullable() {
+		return nullKindOf(t).name
 	}
+	return t
 }
 
+type fqnSorter []*FQN
+
 // Len is part of sort.Interface.
 func (s fqnSorter) Len() int {
 	return len(s)
@@ -107,24 +147,23 @@ func (s fqnSorter) Less(i, j int) bool {
 
 // node key
 func nk(n *Node) string {
-	return nks(n.Space, n.Name)
+	return n.key
 }
 
 func nks(space, name string) string {
 	return space + "___" + name
 }
 
-func GetFullPath(filename string) string {
+func GetFullPath(filename string) (string, error) {
 	if filename == "" {
-		return ""
+		return "", nil
 	}
 	file, err := os.Open(filename) // For read access.
 	if err != nil {
-		log.Print("Error opening: " + filename)
-		log.Fatal(err)
+		return "", err
 	}
 	defer file.Close()
-	return file.Name()
+	return file.Name(), nil
 }
 
 func CapitalizeFirstLetter(s string) string {